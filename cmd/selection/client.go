@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jukeizu/selection/api/protobuf-spec/selectionpb"
+	"github.com/jukeizu/selection/internal/startup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const clientUsage = `Usage: selection [flags] <command> [command flags]
+
+Commands talk to the server at -service.addr:
+
+  create  create or reuse a selection from a JSON or CSV file of options
+  parse   rank a user's input against their selection, -dry-run=false to save it
+  query   rank options of a selection by option id
+  get     show a user's selection
+
+Run selection <command> -h for the flags of a command.
+`
+
+// clientFlags are the flags every client command shares.
+type clientFlags struct {
+	*flag.FlagSet
+
+	appId      string
+	instanceId string
+	userId     string
+	serverId   string
+
+	output  string
+	timeout time.Duration
+	apiKey  string
+
+	tls      bool
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+func newClientFlags(name string) *clientFlags {
+	f := &clientFlags{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+
+	f.StringVar(&f.appId, "app", "", "AppId of the selection")
+	f.StringVar(&f.instanceId, "instance", "", "InstanceId of the selection")
+	f.StringVar(&f.userId, "user", "", "UserId of the selection")
+	f.StringVar(&f.serverId, "server", "", "ServerId of the selection")
+	f.StringVar(&f.output, "o", "table", "Output format: table or json")
+	f.DurationVar(&f.timeout, "timeout", 10*time.Second, "Time to wait for the server")
+	f.StringVar(&f.apiKey, "api-key", os.Getenv("SELECTION_API_KEY"), "API key to call with, defaults to $SELECTION_API_KEY")
+	f.BoolVar(&f.tls, "tls", false, "Connect with TLS, verifying the server against the system roots or -ca")
+	f.StringVar(&f.caFile, "ca", "", "PEM CA bundle to verify the server with. Implies -tls")
+	f.StringVar(&f.certFile, "cert", "", "PEM client certificate for mutual TLS. Implies -tls")
+	f.StringVar(&f.keyFile, "key", "", "PEM private key for -cert")
+
+	return f
+}
+
+func (f *clientFlags) parse(args []string) error {
+	err := f.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if f.output != "table" && f.output != "json" {
+		return fmt.Errorf("unknown output format %q", f.output)
+	}
+
+	return nil
+}
+
+// dial connects to the server and returns a context carrying the API key, to call it
+// with, that expires after the timeout.
+func (f *clientFlags) dial() (selectionpb.SelectionServiceClient, context.Context, func(), error) {
+	creds := insecure.NewCredentials()
+
+	if f.tls || f.caFile != "" || f.certFile != "" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+		if f.caFile != "" {
+			pem, err := os.ReadFile(f.caFile)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, nil, nil, fmt.Errorf("no certificates found in %s", f.caFile)
+			}
+		}
+
+		if f.certFile != "" {
+			cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	conn, err := grpc.Dial(serviceAddress, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	if f.apiKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, startup.ApiKeyMetadataKey, f.apiKey)
+	}
+
+	return selectionpb.NewSelectionServiceClient(conn), ctx, func() {
+		cancel()
+		conn.Close()
+	}, nil
+}
+
+// runClient runs the client command named by args[0] and returns the exit code.
+func runClient(args []string) int {
+	commands := map[string]func([]string, io.Writer) error{
+		"create": runCreate,
+		"parse":  runParse,
+		"query":  runQuery,
+		"get":    runGet,
+	}
+
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], clientUsage)
+		return 2
+	}
+
+	err := command(args[1:], os.Stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "selection %s: %s\n", args[0], err)
+		return 1
+	}
+
+	return 0
+}
+
+func runCreate(args []string, w io.Writer) error {
+	f := newClientFlags("create")
+
+	optionsFile := f.String("options", "", "JSON or CSV file of options, - for JSON on stdin")
+	randomize := f.Bool("randomize", false, "Shuffle the options")
+	regenerate := f.Bool("regenerate", false, "Replace an existing selection instead of reusing it, discarding the user's ballot")
+	batchSize := f.Int("batch-size", 0, "Options per batch, 0 for no batches")
+	sortMethod := f.String("sort", "", "Sort method of the batches: number, random, alphabetical or metadata")
+	sortKey := f.String("sort-key", "", "Metadata key to sort by with -sort metadata")
+	ttl := f.Duration("ttl", 0, "Time until the selection expires, 0 to keep it")
+
+	err := f.parse(args)
+	if err != nil {
+		return err
+	}
+
+	options, err := readOptions(*optionsFile)
+	if err != nil {
+		return err
+	}
+
+	client, ctx, done, err := f.dial()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	reply, err := client.CreateSelection(ctx, &selectionpb.CreateSelectionRequest{
+		AppId:      f.appId,
+		InstanceId: f.instanceId,
+		UserId:     f.userId,
+		ServerId:   f.serverId,
+		Randomize:  *randomize,
+		Regenerate: *regenerate,
+		BatchSize:  int32(*batchSize),
+		SortMethod: *sortMethod,
+		SortKey:    *sortKey,
+		Options:    options,
+		TtlSeconds: int64(ttl.Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+
+	if f.output == "json" {
+		return writeJson(w, reply)
+	}
+
+	fmt.Fprintf(w, "status: %s\n\n", reply.Status)
+
+	return writeBatches(w, reply.Batches)
+}
+
+func runParse(args []string, w io.Writer) error {
+	f := newClientFlags("parse")
+
+	content := f.String("content", "", "Input to parse, such as `1, 3-5`")
+	dryRun := f.Bool("dry-run", true, "Only validate and rank the input. With -dry-run=false the result replaces the user's ballot")
+
+	err := f.parse(args)
+	if err != nil {
+		return err
+	}
+
+	client, ctx, done, err := f.dial()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	reply, err := client.ParseSelection(ctx, &selectionpb.ParseSelectionRequest{
+		AppId:      f.appId,
+		InstanceId: f.instanceId,
+		UserId:     f.userId,
+		ServerId:   f.serverId,
+		Content:    *content,
+		DryRun:     *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	if f.output == "json" {
+		return writeJson(w, reply)
+	}
+
+	return writeRankedOptions(w, reply.RankedOptions)
+}
+
+func runQuery(args []string, w io.Writer) error {
+	f := newClientFlags("query")
+
+	ids := f.String("ids", "", "Comma separated option ids, ranked in the order given")
+
+	err := f.parse(args)
+	if err != nil {
+		return err
+	}
+
+	options := map[string]int32{}
+	for rank, id := range strings.Split(*ids, ",") {
+		id = strings.TrimSpace(id)
+		if id != "" {
+			options[id] = int32(rank)
+		}
+	}
+
+	client, ctx, done, err := f.dial()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	reply, err := client.QuerySelection(ctx, &selectionpb.QuerySelectionRequest{
+		AppId:      f.appId,
+		InstanceId: f.instanceId,
+		UserId:     f.userId,
+		ServerId:   f.serverId,
+		Options:    options,
+	})
+	if err != nil {
+		return err
+	}
+
+	if f.output == "json" {
+		return writeJson(w, reply)
+	}
+
+	fmt.Fprintf(w, "content: %s\n\n", reply.Content)
+
+	return writeRankedOptions(w, reply.Options)
+}
+
+func runGet(args []string, w io.Writer) error {
+	f := newClientFlags("get")
+
+	err := f.parse(args)
+	if err != nil {
+		return err
+	}
+
+	client, ctx, done, err := f.dial()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	reply, err := client.GetSelection(ctx, &selectionpb.GetSelectionRequest{
+		AppId:      f.appId,
+		InstanceId: f.instanceId,
+		UserId:     f.userId,
+		ServerId:   f.serverId,
+	})
+	if err != nil {
+		return err
+	}
+
+	if f.output == "json" {
+		return writeJson(w, reply)
+	}
+
+	selection := reply.Selection
+
+	fmt.Fprintf(w, "id: %s\ncreated: %s\n", selection.Id, selection.Created.AsTime().Format(time.RFC3339))
+	if selection.Updated != nil {
+		fmt.Fprintf(w, "updated: %s\n", selection.Updated.AsTime().Format(time.RFC3339))
+	}
+	if selection.ExpiresAt != nil {
+		fmt.Fprintf(w, "expires: %s\n", selection.ExpiresAt.AsTime().Format(time.RFC3339))
+	}
+
+	fmt.Fprintln(w)
+
+	err = writeNumberedOptions(w, selection.Options)
+	if err != nil || len(selection.Retired) < 1 {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nretired:")
+
+	return writeNumberedOptions(w, selection.Retired)
+}
+
+// readOptions reads options from a JSON file holding an array of options in the
+// protobuf JSON mapping, or from a CSV file with a header row. The CSV columns optionId and content fill those fields and any
+// other column becomes metadata.
+func readOptions(path string) ([]*selectionpb.Option, error) {
+	if path == "" {
+		return nil, errors.New("-options is required")
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return readCsvOptions(r)
+	}
+
+	raw := []json.RawMessage{}
+
+	err := json.NewDecoder(r).Decode(&raw)
+	if err != nil {
+		return nil, fmt.Errorf("could not read options from %s: %s", path, err)
+	}
+
+	options := []*selectionpb.Option{}
+
+	for i, b := range raw {
+		option := &selectionpb.Option{}
+
+		err := protojson.Unmarshal(b, option)
+		if err != nil {
+			return nil, fmt.Errorf("could not read option %d from %s: %s", i, path, err)
+		}
+
+		options = append(options, option)
+	}
+
+	return options, nil
+}
+
+func readCsvOptions(r io.Reader) ([]*selectionpb.Option, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) < 1 {
+		return nil, errors.New("the CSV file has no header row")
+	}
+
+	header := records[0]
+
+	options := []*selectionpb.Option{}
+
+	for _, record := range records[1:] {
+		option := &selectionpb.Option{}
+
+		for i, value := range record {
+			switch header[i] {
+			case "optionId":
+				option.OptionId = value
+			case "content":
+				option.Content = value
+			default:
+				if option.Metadata == nil {
+					option.Metadata = map[string]string{}
+				}
+				option.Metadata[header[i]] = value
+			}
+		}
+
+		options = append(options, option)
+	}
+
+	return options, nil
+}
+
+func writeJson(w io.Writer, m proto.Message) error {
+	b, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(b))
+
+	return err
+}
+
+func writeBatches(w io.Writer, batches []*selectionpb.Batch) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "BATCH\tNUMBER\tOPTION ID\tCONTENT")
+	for i, batch := range batches {
+		for _, batchOption := range batch.Options {
+			fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", i+1, batchOption.Number, batchOption.Option.GetOptionId(), batchOption.Option.GetContent())
+		}
+	}
+
+	return tw.Flush()
+}
+
+func writeRankedOptions(w io.Writer, rankedOptions []*selectionpb.RankedOption) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "RANK\tNUMBER\tOPTION ID\tCONTENT")
+	for _, rankedOption := range rankedOptions {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", rankedOption.Rank, rankedOption.Number, rankedOption.Option.GetOptionId(), rankedOption.Option.GetContent())
+	}
+
+	return tw.Flush()
+}
+
+func writeNumberedOptions(w io.Writer, options map[int32]*selectionpb.Option) error {
+	numbers := []int{}
+	for number := range options {
+		numbers = append(numbers, int(number))
+	}
+	sort.Ints(numbers)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NUMBER\tOPTION ID\tCONTENT")
+	for _, number := range numbers {
+		option := options[int32(number)]
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", number, option.GetOptionId(), option.GetContent())
+	}
+
+	return tw.Flush()
+}
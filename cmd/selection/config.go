@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jukeizu/selection/internal/startup"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the name of every environment variable the config is read from.
+// The rest of the name is the flag name in upper case with dots and dashes as
+// underscores, so -grpc.port is read from SELECTION_GRPC_PORT.
+const EnvPrefix = "SELECTION_"
+
+// commandFlags control what the binary does rather than configure it, so they are only
+// read from the command line.
+var commandFlags = map[string]bool{
+	"config":       true,
+	"print-config": true,
+	"v":            true,
+}
+
+// secretFlags hold values that must not be printed in full.
+var secretFlags = map[string]func(string) string{
+	"db": redactDsn,
+}
+
+// loadConfig layers the config file named by -config and the SELECTION_* environment
+// variables between the flag defaults and the flags set on the command line. Settings
+// in the file are the flag names, either dotted or nested, as in
+//
+//	grpc:
+//	  port: "50055"
+//	prune.interval: 5m
+//
+// for YAML, or the equivalent TOML. Lists are joined with commas.
+func loadConfig(fs *flag.FlagSet, configFile string) error {
+	explicit := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	set := func(name, value, source string) error {
+		err := fs.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid value %q for %s: %s", source, value, name, err)
+		}
+
+		return nil
+	}
+
+	if configFile != "" {
+		settings, err := readConfigFile(configFile)
+		if err != nil {
+			return err
+		}
+
+		names := []string{}
+		for name := range settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if fs.Lookup(name) == nil || commandFlags[name] {
+				return fmt.Errorf("%s: unknown setting %q", configFile, name)
+			}
+
+			err := set(name, settings[name], configFile)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	errs := []error{}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if commandFlags[f.Name] {
+			return
+		}
+
+		env := envName(f.Name)
+
+		value, ok := os.LookupEnv(env)
+		if ok {
+			errs = append(errs, set(f.Name, value, env))
+		}
+	})
+
+	for name, value := range explicit {
+		errs = append(errs, set(name, value, "-"+name))
+	}
+
+	return errors.Join(errs...)
+}
+
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+// readConfigFile reads a YAML or TOML file, chosen by its extension, into settings keyed
+// by flag name.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := map[string]interface{}{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("%s: config files must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	settings := map[string]string{}
+
+	err = flattenConfig(settings, "", tree)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return settings, nil
+}
+
+func flattenConfig(settings map[string]string, prefix string, tree map[string]interface{}) error {
+	for key, value := range tree {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			err := flattenConfig(settings, name, v)
+			if err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			settings[name] = strings.Join(items, ",")
+		case nil:
+			settings[name] = ""
+		default:
+			settings[name] = fmt.Sprint(v)
+		}
+	}
+
+	return nil
+}
+
+// validateConfig checks the settings that flag parsing alone cannot.
+func validateConfig() error {
+	errs := []error{}
+
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	}
+
+	check(dbAddress != "", "-db must be set")
+	check(grpcPort != "", "-grpc.port must be set")
+	check(serviceAddress != "", "-service.addr must be set")
+	check(pruneInterval >= 0, "-prune.interval must not be negative")
+	check(healthInterval > 0, "-health.interval must be positive")
+	check(retryPolicy.MaxAttempts >= 1, "-db.retry.attempts must be at least 1")
+	check(retryPolicy.BaseDelay >= 0, "-db.retry.base must not be negative")
+	check(retryPolicy.MaxDelay >= retryPolicy.BaseDelay, "-db.retry.max must not be less than -db.retry.base")
+	check(poolConfig.MaxOpenConns >= 0, "-db.pool.maxopen must not be negative")
+	check(poolConfig.MaxIdleConns >= 0, "-db.pool.maxidle must not be negative")
+	check(poolConfig.ConnMaxLifetime >= 0, "-db.pool.maxlifetime must not be negative")
+	check(poolConfig.ConnMaxIdleTime >= 0, "-db.pool.maxidletime must not be negative")
+	check(keepaliveTime > 0, "-grpc.keepalive.time must be positive")
+	check(keepaliveTimeout > 0, "-grpc.keepalive.timeout must be positive")
+	check(keepaliveMinTime >= 0, "-grpc.keepalive.mintime must not be negative")
+
+	ports := []struct{ name, port string }{
+		{"grpc.port", grpcPort},
+		{"health.port", healthPort},
+		{"metrics.port", metricsPort},
+		{"http.port", httpPort},
+	}
+
+	for _, p := range ports {
+		if p.port == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(p.port)
+		check(err == nil && n >= 0 && n <= 65535, "-%s %q is not a port number", p.name, p.port)
+	}
+
+	_, err := zerolog.ParseLevel(logLevel)
+	check(err == nil, "-log.level %q is not a log level", logLevel)
+
+	_, err = startup.ParseMethodLevels(logMethods)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("-log.methods: %s", err))
+	}
+
+	switch traceExporter {
+	case startup.TraceExporterNone, startup.TraceExporterStdout, startup.TraceExporterOtlp:
+	case startup.TraceExporterFile:
+		check(traceFile != "", "-trace.exporter file needs -trace.file")
+	default:
+		errs = append(errs, fmt.Errorf("-trace.exporter %q is not one of stdout, file or otlp", traceExporter))
+	}
+
+	err = startup.ValidateTlsFlags(tlsCert, tlsKey, tlsClientCa)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// printConfig writes the effective value of every setting to w as YAML, with secrets
+// redacted.
+func printConfig(w io.Writer, fs *flag.FlagSet) error {
+	settings := map[string]string{}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if commandFlags[f.Name] {
+			return
+		}
+
+		value := f.Value.String()
+		if redact, ok := secretFlags[f.Name]; ok {
+			value = redact(value)
+		}
+
+		settings[f.Name] = value
+	})
+
+	b, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
+
+// redacted replaces secrets in printed settings.
+const redacted = "REDACTED"
+
+// redactDsn hides the password of a database URL, of a bare CockroachDB address such as
+// user:password@host:26257, and of a password query parameter. A value that cannot be
+// parsed is hidden entirely.
+func redactDsn(dsn string) string {
+	scheme := ""
+	if !strings.Contains(dsn, "://") {
+		scheme = "postgresql://"
+	}
+
+	u, err := url.Parse(scheme + dsn)
+	if err != nil {
+		return redacted
+	}
+
+	changed := false
+
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			changed = true
+		}
+	}
+
+	query := u.Query()
+	if query.Has("password") {
+		query.Set("password", redacted)
+		u.RawQuery = query.Encode()
+		changed = true
+	}
+
+	if !changed {
+		return dsn
+	}
+
+	return strings.TrimPrefix(u.String(), scheme)
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,36 +20,107 @@ import (
 	"github.com/jukeizu/selection/selection"
 	_ "github.com/lib/pq"
 	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
 	"github.com/shawntoffel/gossage"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 )
 
 var Version = ""
 
+// selectionServiceName is the grpc name of selectionpb's SelectionService.
+const selectionServiceName = "selection.v1.SelectionService"
+
 var (
 	flagMigrate = false
 	flagVersion = false
 	flagServer  = true
 
+	configFile      = ""
+	flagPrintConfig = false
+
 	grpcPort       = "50055"
 	dbAddress      = "root@localhost:26257"
 	serviceAddress = "localhost:" + grpcPort
+	pruneInterval  = time.Minute
+	retryPolicy    = selection.DefaultRetryPolicy
+	healthInterval = 10 * time.Second
+	healthPort     = ""
+	metricsPort    = ""
+	traceExporter  = startup.TraceExporterNone
+	traceFile      = ""
+	logMethods     = ""
+	tlsCert        = ""
+	tlsKey         = ""
+	tlsClientCa    = ""
+	authKeys       = ""
+	authAdmin      = "ListSelections,DeleteSelection"
+	httpPort       = ""
+	logLevel       = zerolog.InfoLevel.String()
+	poolConfig     = selection.DefaultPoolConfig
+
+	keepaliveTime                = 5 * time.Minute
+	keepaliveTimeout             = 10 * time.Second
+	keepaliveMinTime             = 5 * time.Second
+	keepalivePermitWithoutStream = true
 )
 
 func parseConfig() {
 	flag.StringVar(&grpcPort, "grpc.port", grpcPort, "grpc port for server")
-	flag.StringVar(&dbAddress, "db", dbAddress, "Database connection address")
+	flag.StringVar(&dbAddress, "db", dbAddress, "CockroachDB address, postgresql:// DSN for PostgreSQL or CockroachDB, sqlite://path for an SQLite file, or memory:// to keep selections in memory")
 	flag.StringVar(&serviceAddress, "service.addr", serviceAddress, "address of service if not local")
+	flag.DurationVar(&pruneInterval, "prune.interval", pruneInterval, "Interval between removals of expired selections. Zero disables pruning")
+	flag.IntVar(&retryPolicy.MaxAttempts, "db.retry.attempts", retryPolicy.MaxAttempts, "Attempts per database call before a retryable error is returned. 1 disables retries")
+	flag.DurationVar(&retryPolicy.BaseDelay, "db.retry.base", retryPolicy.BaseDelay, "Backoff before the first database retry, doubled for every further retry")
+	flag.DurationVar(&retryPolicy.MaxDelay, "db.retry.max", retryPolicy.MaxDelay, "Maximum backoff between database retries")
+	flag.DurationVar(&healthInterval, "health.interval", healthInterval, "Interval between database pings that drive the grpc health status")
+	flag.StringVar(&healthPort, "health.port", healthPort, "http port for /healthz and /readyz. Empty disables the endpoints")
+	flag.StringVar(&metricsPort, "metrics.port", metricsPort, "http port for Prometheus /metrics. Empty disables the endpoint")
+	flag.StringVar(&traceExporter, "trace.exporter", traceExporter, "OpenTelemetry span exporter: stdout, file, or otlp configured by OTEL_EXPORTER_OTLP_* variables. Empty disables tracing")
+	flag.StringVar(&traceFile, "trace.file", traceFile, "File the file trace exporter appends spans to")
+	flag.StringVar(&logMethods, "log.methods", logMethods, "Comma separated method=level pairs setting the level successful calls are logged at, such as QuerySelection=debug")
+	flag.StringVar(&tlsCert, "tls.cert", tlsCert, "PEM server certificate file. Serves grpc over TLS when set, reloaded when the file changes")
+	flag.StringVar(&tlsKey, "tls.key", tlsKey, "PEM private key file for -tls.cert")
+	flag.StringVar(&tlsClientCa, "tls.clientca", tlsClientCa, "PEM CA bundle client certificates must be signed by. Requires mutual TLS when set")
+	flag.StringVar(&authKeys, "auth.keys", authKeys, "JSON file of API keys and the AppIds each may use. Empty disables authentication")
+	flag.StringVar(&authAdmin, "auth.admin", authAdmin, "Comma separated methods that need an admin API key")
+	flag.StringVar(&httpPort, "http.port", httpPort, "http port for the JSON gateway to CreateSelection, ParseSelection and QuerySelection. Served over TLS with -tls.cert. Empty disables the gateway")
+	flag.IntVar(&poolConfig.MaxOpenConns, "db.pool.maxopen", poolConfig.MaxOpenConns, "Maximum open database connections. Zero is unlimited")
+	flag.IntVar(&poolConfig.MaxIdleConns, "db.pool.maxidle", poolConfig.MaxIdleConns, "Maximum idle database connections kept for reuse")
+	flag.DurationVar(&poolConfig.ConnMaxLifetime, "db.pool.maxlifetime", poolConfig.ConnMaxLifetime, "Maximum time a database connection is reused. Zero is forever")
+	flag.DurationVar(&poolConfig.ConnMaxIdleTime, "db.pool.maxidletime", poolConfig.ConnMaxIdleTime, "Maximum time a database connection stays idle. Zero is forever")
+	flag.DurationVar(&keepaliveTime, "grpc.keepalive.time", keepaliveTime, "Idle time after which the server pings a grpc client")
+	flag.DurationVar(&keepaliveTimeout, "grpc.keepalive.timeout", keepaliveTimeout, "Time the server waits for a keepalive ping to be answered before closing the connection")
+	flag.DurationVar(&keepaliveMinTime, "grpc.keepalive.mintime", keepaliveMinTime, "Minimum time clients must wait between keepalive pings")
+	flag.BoolVar(&keepalivePermitWithoutStream, "grpc.keepalive.permitwithoutstream", keepalivePermitWithoutStream, "Allow client keepalive pings when there are no active streams")
+	flag.StringVar(&logLevel, "log.level", logLevel, "Minimum level logged: trace, debug, info, warn, error, fatal or panic")
 	flag.BoolVar(&flagServer, "server", flagServer, "Run as server")
 	flag.BoolVar(&flagMigrate, "migrate", flagMigrate, "Run db migrations")
 	flag.BoolVar(&flagVersion, "v", flagVersion, "version")
+	flag.StringVar(&configFile, "config", configFile, "YAML or TOML file of settings named after these flags. Overridden by "+EnvPrefix+"* environment variables, which are overridden by flags")
+	flag.BoolVar(&flagPrintConfig, "print-config", flagPrintConfig, "Print the effective configuration with secrets redacted and exit")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\n%s", clientUsage)
+	}
 
 	flag.Parse()
+
+	err := loadConfig(flag.CommandLine, configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 }
 
 func main() {
@@ -56,6 +131,28 @@ func main() {
 		os.Exit(0)
 	}
 
+	if flag.NArg() > 0 {
+		os.Exit(runClient(flag.Args()))
+	}
+
+	err := validateConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if flagPrintConfig {
+		err := printConfig(os.Stdout, flag.CommandLine)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	level, _ := zerolog.ParseLevel(logLevel)
+	zerolog.SetGlobalLevel(level)
+
 	logger := zerolog.New(os.Stdout).With().Timestamp().
 		Str("instance", xid.New().String()).
 		Str("component", "selection").
@@ -65,12 +162,31 @@ func main() {
 	grpcLoggerV2 := grpczerolog.New(logger.With().Str("transport", "grpc").Logger())
 	grpclog.SetLoggerV2(grpcLoggerV2)
 
-	repository, err := selection.NewRepository(dbAddress)
+	tracerProvider, err := startup.NewTracerProvider(traceExporter, traceFile, Version)
+	if err != nil {
+		logger.Error().Err(err).Caller().Msg("could not create tracer provider")
+		os.Exit(1)
+	}
+	if tracerProvider != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			err := tracerProvider.Shutdown(ctx)
+			if err != nil {
+				logger.Error().Err(err).Caller().Msg("could not flush spans")
+			}
+		}()
+	}
+
+	repository, err := selection.NewRepository(dbAddress, poolConfig)
 	if err != nil {
 		logger.Error().Err(err).Caller().Msg("could not create selection repository")
 		os.Exit(1)
 	}
 
+	repository = selection.NewRetryRepository(logger.With().Str("component", "repository").Logger(), selection.NewTracingRepository(selection.NewMetricsRepository(repository)), retryPolicy)
+
 	if flagMigrate {
 		gossage.Logger = func(format string, a ...interface{}) {
 			msg := fmt.Sprintf(format, a...)
@@ -84,26 +200,132 @@ func main() {
 		}
 	}
 
+	if !flagServer {
+		return
+	}
+
 	g := run.Group{}
 
-	if flagServer {
-		grpcServer := newGrpcServer(logger)
-		server := startup.NewServer(logger, grpcServer)
+	methodLevels, err := startup.ParseMethodLevels(logMethods)
+	if err != nil {
+		logger.Error().Err(err).Caller().Msg("invalid -log.methods")
+		os.Exit(1)
+	}
+
+	opts := []grpc.ServerOption{}
+
+	var tlsConfig *tls.Config
+
+	if tlsCert != "" {
+		tlsConfig, err = startup.NewTlsConfig(logger.With().Str("component", "tls").Logger(), tlsCert, tlsKey, tlsClientCa)
+		if err != nil {
+			logger.Error().Err(err).Caller().Msg("could not load tls certificates")
+			os.Exit(1)
+		}
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	var authorizer *startup.Authorizer
+
+	if authKeys != "" {
+		keyStore, err := startup.NewFileKeyStore(logger.With().Str("component", "auth").Logger(), authKeys)
+		if err != nil {
+			logger.Error().Err(err).Caller().Msg("could not load api keys")
+			os.Exit(1)
+		}
+
+		authorizer = startup.NewAuthorizer(keyStore, []string{selectionServiceName}, strings.Split(authAdmin, ","))
+	}
+
+	keepaliveParams := keepalive.ServerParameters{
+		Time:    keepaliveTime,
+		Timeout: keepaliveTimeout,
+	}
+	keepalivePolicy := keepalive.EnforcementPolicy{
+		MinTime:             keepaliveMinTime,
+		PermitWithoutStream: keepalivePermitWithoutStream,
+	}
+
+	grpcServer := newGrpcServer(logger, methodLevels, authorizer, keepaliveParams, keepalivePolicy, opts...)
+	healthServer := health.NewServer()
+	server := startup.NewServer(logger, grpcServer, healthServer)
+
+	sorter := selection.NewSorter(logger)
+	batcher := selection.NewBatcher(logger)
+	tallier := selection.NewTallier(logger)
+
+	selectionService := selection.NewTracingService(selection.NewDefaultService(logger, repository, sorter, batcher, tallier))
+	selectionServer := selection.NewGrpcServer(logger, selectionService)
+	selectionpb.RegisterSelectionServiceServer(grpcServer, selectionServer)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	reflection.Register(grpcServer)
+
+	grpcAddr := ":" + grpcPort
+
+	g.Add(func() error {
+		return server.Start(grpcAddr)
+	}, func(error) {
+		server.Stop()
+	})
+
+	if httpPort != "" {
+		gateway := selection.NewHttpGateway(logger, selectionServer, startup.UnaryInterceptor(logger, methodLevels, authorizer))
+		gatewayServer := startup.NewTlsHttpServer(logger, gateway, tlsConfig)
+		httpAddr := ":" + httpPort
+
+		g.Add(func() error {
+			return gatewayServer.Start(httpAddr)
+		}, func(error) {
+			gatewayServer.Stop()
+		})
+	}
+
+	services := []string{}
+	for service := range grpcServer.GetServiceInfo() {
+		services = append(services, service)
+	}
 
-		sorter := selection.NewSorter(logger)
-		batcher := selection.NewBatcher(logger)
+	healthChecker := startup.NewHealthChecker(logger.With().Str("component", "health").Logger(), healthServer, repository, healthInterval, services...)
 
-		selectionService := selection.NewDefaultService(logger, repository, sorter, batcher)
-		selectionServer := selection.NewGrpcServer(selectionService)
-		selectionpb.RegisterSelectionServiceServer(grpcServer, selectionServer)
-		reflection.Register(grpcServer)
+	g.Add(func() error {
+		return healthChecker.Start()
+	}, func(error) {
+		healthChecker.Stop()
+	})
 
-		grpcAddr := ":" + grpcPort
+	if healthPort != "" {
+		healthHttpServer := startup.NewHttpServer(logger, startup.HealthHandler(healthServer))
+		healthAddr := ":" + healthPort
 
 		g.Add(func() error {
-			return server.Start(grpcAddr)
+			return healthHttpServer.Start(healthAddr)
 		}, func(error) {
-			server.Stop()
+			healthHttpServer.Stop()
+		})
+	}
+
+	if metricsPort != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+
+		metricsServer := startup.NewHttpServer(logger, mux)
+		metricsAddr := ":" + metricsPort
+
+		g.Add(func() error {
+			return metricsServer.Start(metricsAddr)
+		}, func(error) {
+			metricsServer.Stop()
+		})
+	}
+
+	if pruneInterval > 0 {
+		pruner := selection.NewPruner(logger.With().Str("component", "pruner").Logger(), repository, pruneInterval)
+
+		g.Add(func() error {
+			return pruner.Start()
+		}, func(error) {
+			pruner.Stop()
 		})
 	}
 
@@ -129,22 +351,16 @@ func interrupt(cancel <-chan struct{}) error {
 	}
 }
 
-func newGrpcServer(logger zerolog.Logger) *grpc.Server {
-	grpcServer := grpc.NewServer(
-		grpc.KeepaliveParams(
-			keepalive.ServerParameters{
-				Time:    5 * time.Minute,
-				Timeout: 10 * time.Second,
-			},
-		),
-		grpc.KeepaliveEnforcementPolicy(
-			keepalive.EnforcementPolicy{
-				MinTime:             5 * time.Second,
-				PermitWithoutStream: true,
-			},
-		),
-		startup.LoggingInterceptor(logger),
+func newGrpcServer(logger zerolog.Logger, methodLevels startup.MethodLevels, authorizer *startup.Authorizer, keepaliveParams keepalive.ServerParameters, keepalivePolicy keepalive.EnforcementPolicy, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.KeepaliveParams(keepaliveParams),
+		grpc.KeepaliveEnforcementPolicy(keepalivePolicy),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
 	)
 
+	opts = append(opts, startup.Interceptors(logger, methodLevels, authorizer)...)
+
+	grpcServer := grpc.NewServer(opts...)
+
 	return grpcServer
 }
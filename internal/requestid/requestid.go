@@ -0,0 +1,37 @@
+// Package requestid carries the ID of the request being served through a context so
+// that every log line written for the request can include it.
+package requestid
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+// MetadataKey is the gRPC metadata key a caller may set to choose the request ID, and
+// the response header the ID is returned in.
+const MetadataKey = "x-request-id"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Logger returns logger with a requestId field for the request ID carried by ctx, or
+// logger itself if ctx carries none.
+func Logger(ctx context.Context, logger zerolog.Logger) zerolog.Logger {
+	id := FromContext(ctx)
+	if id == "" {
+		return logger
+	}
+
+	return logger.With().Str("requestId", id).Logger()
+}
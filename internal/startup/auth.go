@@ -0,0 +1,277 @@
+package startup
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ApiKeyMetadataKey is the gRPC metadata key clients send their API key in.
+const ApiKeyMetadataKey = "x-api-key"
+
+// ApiKey is a key a client authenticates with and what it may do.
+type ApiKey struct {
+	// Name identifies the key in logs. The key itself is never logged.
+	Name string `json:"name"`
+	Key  string `json:"key"`
+
+	// AppIds are the applications whose selections the key may use.
+	AppIds []string `json:"appIds"`
+
+	// Admin keys may use every application and call admin-only methods.
+	Admin bool `json:"admin"`
+
+	// Subject, if set, must match the subject of the client certificate the caller
+	// authenticated with.
+	Subject string `json:"subject"`
+}
+
+func (k ApiKey) allowsApp(appId string) bool {
+	if k.Admin {
+		return true
+	}
+
+	for _, allowed := range k.AppIds {
+		if allowed == appId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KeyStore looks up API keys.
+type KeyStore interface {
+	Lookup(key string) (ApiKey, bool)
+}
+
+// FileKeyStore is a KeyStore backed by a JSON file of the form
+//
+//	{"keys": [{"name": "bot", "key": "secret", "appIds": ["app"]}]}
+//
+// The file is read again on lookup when it has changed. If the new file fails to load,
+// the error is logged and the previous keys stay in use.
+type FileKeyStore struct {
+	logger zerolog.Logger
+	path   string
+
+	mu       sync.Mutex
+	modified time.Time
+	keys     []ApiKey
+}
+
+type keyFile struct {
+	Keys []ApiKey `json:"keys"`
+}
+
+// NewFileKeyStore constructs a FileKeyStore from the key file at path.
+func NewFileKeyStore(logger zerolog.Logger, path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{logger: logger, path: path}
+
+	err := s.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileKeyStore) Lookup(key string) (ApiKey, bool) {
+	err := s.reload()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("could not reload api keys, keeping the previous ones")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, apiKey := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(apiKey.Key), []byte(key)) == 1 {
+			return apiKey, true
+		}
+	}
+
+	return ApiKey{}, false
+}
+
+func (s *FileKeyStore) reload() error {
+	modified, err := latestModTime(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys != nil && !modified.After(s.modified) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	file := keyFile{}
+
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %s", s.path, err)
+	}
+
+	keys := []ApiKey{}
+	for i, apiKey := range file.Keys {
+		if apiKey.Key == "" {
+			return fmt.Errorf("key %d (%s) in %s is empty", i, apiKey.Name, s.path)
+		}
+
+		keys = append(keys, apiKey)
+	}
+
+	if s.keys != nil {
+		s.logger.Info().Int("numKeys", len(keys)).Msg("reloaded api keys")
+	}
+
+	s.keys = keys
+	s.modified = modified
+
+	return nil
+}
+
+// Authorizer admits calls to the methods of the services it protects only with an API
+// key that allows the AppId of every request message. Calls to other services, such
+// as health checks, are let through.
+type Authorizer struct {
+	keyStore     KeyStore
+	services     []string
+	adminMethods map[string]bool
+}
+
+// NewAuthorizer constructs a new Authorizer that checks keys against keyStore for calls
+// to services. adminMethods are method names, such as ListSelections, that need an
+// admin key.
+func NewAuthorizer(keyStore KeyStore, services []string, adminMethods []string) *Authorizer {
+	admin := map[string]bool{}
+	for _, method := range adminMethods {
+		admin[strings.TrimSpace(method)] = true
+	}
+
+	return &Authorizer{keyStore, services, admin}
+}
+
+// appRequest is implemented by every request message that names an application.
+type appRequest interface {
+	GetAppId() string
+}
+
+func (a *Authorizer) protects(fullMethod string) bool {
+	for _, service := range a.services {
+		if strings.HasPrefix(fullMethod, "/"+service+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authenticate returns the API key the call in ctx to fullMethod was made with, or an
+// Unauthenticated or PermissionDenied status error.
+func (a *Authorizer) authenticate(ctx context.Context, fullMethod string) (ApiKey, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	values := md.Get(ApiKeyMetadataKey)
+	if len(values) < 1 || values[0] == "" {
+		return ApiKey{}, status.Error(codes.Unauthenticated, "missing api key")
+	}
+
+	apiKey, ok := a.keyStore.Lookup(values[0])
+	if !ok {
+		return ApiKey{}, status.Error(codes.Unauthenticated, "invalid api key")
+	}
+
+	if apiKey.Subject != "" && apiKey.Subject != ClientSubject(ctx) {
+		return ApiKey{}, status.Errorf(codes.PermissionDenied, "api key %s is not valid for this client certificate", apiKey.Name)
+	}
+
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	if a.adminMethods[method] && !apiKey.Admin {
+		return ApiKey{}, status.Errorf(codes.PermissionDenied, "%s requires an admin api key", method)
+	}
+
+	return apiKey, nil
+}
+
+// authorize checks that apiKey allows the application req is for.
+func authorize(apiKey ApiKey, req interface{}) error {
+	appReq, ok := req.(appRequest)
+	if !ok {
+		if apiKey.Admin {
+			return nil
+		}
+
+		return status.Error(codes.PermissionDenied, "request does not name an application")
+	}
+
+	if !apiKey.allowsApp(appReq.GetAppId()) {
+		return status.Errorf(codes.PermissionDenied, "api key %s may not use app %q", apiKey.Name, appReq.GetAppId())
+	}
+
+	return nil
+}
+
+func (a *Authorizer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !a.protects(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	apiKey, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(apiKey, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (a *Authorizer) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !a.protects(info.FullMethod) {
+		return handler(srv, ss)
+	}
+
+	apiKey, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, authorizedStream{ss, apiKey})
+}
+
+// authorizedStream checks every message received on a stream against its API key.
+type authorizedStream struct {
+	grpc.ServerStream
+	apiKey ApiKey
+}
+
+func (s authorizedStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+
+	return authorize(s.apiKey, m)
+}
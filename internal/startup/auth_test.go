@@ -0,0 +1,257 @@
+package startup
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type mapKeyStore map[string]ApiKey
+
+func (s mapKeyStore) Lookup(key string) (ApiKey, bool) {
+	apiKey, ok := s[key]
+	return apiKey, ok
+}
+
+type appRequestMessage struct {
+	appId string
+}
+
+func (r appRequestMessage) GetAppId() string {
+	return r.appId
+}
+
+type otherRequestMessage struct{}
+
+func testAuthorizer() *Authorizer {
+	keys := mapKeyStore{
+		"bot-key":     {Name: "bot", Key: "bot-key", AppIds: []string{"app", "other-app"}},
+		"admin-key":   {Name: "admin", Key: "admin-key", Admin: true},
+		"subject-key": {Name: "pinned", Key: "subject-key", AppIds: []string{"app"}, Subject: "CN=bot"},
+	}
+
+	return NewAuthorizer(keys, []string{"selection.v1.SelectionService"}, []string{"ListSelections", " DeleteSelection"})
+}
+
+func withApiKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(ApiKeyMetadataKey, key))
+}
+
+func withClientSubject(ctx context.Context, commonName string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+
+	return peer.NewContext(ctx, &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+	})
+}
+
+func TestAuthorizerUnaryInterceptor(t *testing.T) {
+	const (
+		parse = "/selection.v1.SelectionService/ParseSelection"
+		list  = "/selection.v1.SelectionService/ListSelections"
+		del   = "/selection.v1.SelectionService/DeleteSelection"
+		check = "/grpc.health.v1.Health/Check"
+	)
+
+	tests := []struct {
+		name    string
+		method  string
+		key     string
+		subject string
+		req     interface{}
+		want    codes.Code
+	}{
+		{"allowed app", parse, "bot-key", "", appRequestMessage{"app"}, codes.OK},
+		{"second allowed app", parse, "bot-key", "", appRequestMessage{"other-app"}, codes.OK},
+		{"other app", parse, "bot-key", "", appRequestMessage{"someone-else"}, codes.PermissionDenied},
+		{"empty app", parse, "bot-key", "", appRequestMessage{""}, codes.PermissionDenied},
+		{"missing key", parse, "", "", appRequestMessage{"app"}, codes.Unauthenticated},
+		{"unknown key", parse, "guess", "", appRequestMessage{"app"}, codes.Unauthenticated},
+		{"admin method", list, "bot-key", "", appRequestMessage{"app"}, codes.PermissionDenied},
+		{"trimmed admin method", del, "bot-key", "", appRequestMessage{"app"}, codes.PermissionDenied},
+		{"admin key on admin method", list, "admin-key", "", appRequestMessage{""}, codes.OK},
+		{"admin key on any app", parse, "admin-key", "", appRequestMessage{"someone-else"}, codes.OK},
+		{"request without app", parse, "bot-key", "", otherRequestMessage{}, codes.PermissionDenied},
+		{"admin request without app", parse, "admin-key", "", otherRequestMessage{}, codes.OK},
+		{"unprotected service", check, "", "", otherRequestMessage{}, codes.OK},
+		{"matching subject", parse, "subject-key", "bot", appRequestMessage{"app"}, codes.OK},
+		{"other subject", parse, "subject-key", "mallory", appRequestMessage{"app"}, codes.PermissionDenied},
+		{"no client certificate", parse, "subject-key", "", appRequestMessage{"app"}, codes.PermissionDenied},
+	}
+
+	authorizer := testAuthorizer()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := withApiKey(context.Background(), test.key)
+			if test.subject != "" {
+				ctx = withClientSubject(ctx, test.subject)
+			}
+
+			called := false
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				return "ok", nil
+			}
+
+			_, err := authorizer.unaryInterceptor(ctx, test.req, &grpc.UnaryServerInfo{FullMethod: test.method}, handler)
+
+			if got := status.Code(err); got != test.want {
+				t.Errorf("code = %s, want %s (%v)", got, test.want, err)
+			}
+
+			if called != (test.want == codes.OK) {
+				t.Errorf("handler called = %t, want %t", called, test.want == codes.OK)
+			}
+		})
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	messages []appRequestMessage
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testServerStream) RecvMsg(m interface{}) error {
+	*(m.(*appRequestMessage)) = s.messages[0]
+	s.messages = s.messages[1:]
+	return nil
+}
+
+func TestAuthorizerStreamInterceptor(t *testing.T) {
+	authorizer := testAuthorizer()
+	info := &grpc.StreamServerInfo{FullMethod: "/selection.v1.SelectionService/ParseSelection"}
+
+	stream := &testServerStream{
+		ctx:      withApiKey(context.Background(), "bot-key"),
+		messages: []appRequestMessage{{"app"}, {"someone-else"}},
+	}
+
+	codesReceived := []codes.Code{}
+
+	err := authorizer.streamInterceptor(nil, stream, info, func(srv interface{}, ss grpc.ServerStream) error {
+		for i := 0; i < 2; i++ {
+			m := &appRequestMessage{}
+			codesReceived = append(codesReceived, status.Code(ss.RecvMsg(m)))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("streamInterceptor returned error: %s", err)
+	}
+
+	if len(codesReceived) != 2 || codesReceived[0] != codes.OK || codesReceived[1] != codes.PermissionDenied {
+		t.Errorf("RecvMsg codes = %v, want [OK PermissionDenied]", codesReceived)
+	}
+
+	unauthenticated := &testServerStream{ctx: context.Background()}
+
+	err = authorizer.streamInterceptor(nil, unauthenticated, info, func(srv interface{}, ss grpc.ServerStream) error {
+		t.Error("handler called without an api key")
+		return nil
+	})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("code = %s, want %s", status.Code(err), codes.Unauthenticated)
+	}
+}
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	write := func(content string, modified time.Time) {
+		err := os.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chtimes(path, modified, modified)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	write(`{"keys": [{"name": "bot", "key": "first", "appIds": ["app"]}]}`, now)
+
+	store, err := NewFileKeyStore(zerolog.Nop(), path)
+	if err != nil {
+		t.Fatalf("NewFileKeyStore returned error: %s", err)
+	}
+
+	apiKey, ok := store.Lookup("first")
+	if !ok || apiKey.Name != "bot" || len(apiKey.AppIds) != 1 || apiKey.AppIds[0] != "app" {
+		t.Errorf("Lookup(first) = %+v, %t", apiKey, ok)
+	}
+
+	if _, ok := store.Lookup("second"); ok {
+		t.Error("Lookup(second) found a key that is not in the file")
+	}
+
+	write(`{"keys": [{"name": "bot", "key": "second"}]}`, now.Add(time.Minute))
+
+	if _, ok := store.Lookup("second"); !ok {
+		t.Error("Lookup(second) did not find the key after the file changed")
+	}
+	if _, ok := store.Lookup("first"); ok {
+		t.Error("Lookup(first) found a key removed from the file")
+	}
+
+	write(`{"keys": [`, now.Add(2*time.Minute))
+
+	if _, ok := store.Lookup("second"); !ok {
+		t.Error("Lookup(second) did not keep the previous keys when the file became invalid")
+	}
+}
+
+func TestNewFileKeyStoreInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"invalid json", `{"keys": `},
+		{"empty key", `{"keys": [{"name": "bot", "key": ""}]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+
+			err := os.WriteFile(path, []byte(test.content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = NewFileKeyStore(zerolog.Nop(), path)
+			if err == nil {
+				t.Error("NewFileKeyStore returned no error")
+			}
+		})
+	}
+
+	_, err := NewFileKeyStore(zerolog.Nop(), filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Error("NewFileKeyStore returned no error for a missing file")
+	}
+}
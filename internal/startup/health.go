@@ -0,0 +1,133 @@
+package startup
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Pinger checks that a dependency the server needs is reachable.
+type Pinger interface {
+	Ping(context.Context) error
+}
+
+// HealthChecker pings a dependency every interval and reports the result as the
+// serving status of the overall server and of each of services.
+type HealthChecker struct {
+	logger   zerolog.Logger
+	health   *health.Server
+	pinger   Pinger
+	interval time.Duration
+	services []string
+	stop     chan struct{}
+}
+
+// NewHealthChecker constructs a new HealthChecker that updates health every interval.
+func NewHealthChecker(logger zerolog.Logger, health *health.Server, pinger Pinger, interval time.Duration, services ...string) HealthChecker {
+	return HealthChecker{logger, health, pinger, interval, services, make(chan struct{})}
+}
+
+// Start checks the dependency right away and then every interval until Stop is called.
+// Everything is NOT_SERVING until the first check succeeds.
+func (h HealthChecker) Start() error {
+	h.logger.Info().
+		Str("interval", h.interval.String()).
+		Msg("starting health checker")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-h.stop
+		cancel()
+	}()
+
+	h.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	serving := h.check(ctx, false)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			serving = h.check(ctx, serving)
+		}
+	}
+}
+
+// Stop stops the health checker.
+func (h HealthChecker) Stop() {
+	h.logger.Info().Msg("stopping health checker")
+
+	close(h.stop)
+}
+
+// check pings the dependency and updates the serving status, logging only when it
+// changes from wasServing.
+func (h HealthChecker) check(ctx context.Context, wasServing bool) bool {
+	ctx, cancel := context.WithTimeout(ctx, h.interval)
+	defer cancel()
+
+	err := h.pinger.Ping(ctx)
+	if ctx.Err() == context.Canceled {
+		return wasServing
+	}
+
+	serving := err == nil
+
+	if serving {
+		h.setStatus(healthpb.HealthCheckResponse_SERVING)
+	} else {
+		h.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+
+	if serving == wasServing {
+		return serving
+	}
+
+	if serving {
+		h.logger.Info().Msg("serving")
+	} else {
+		h.logger.Error().Err(err).Msg("not serving, health check failed")
+	}
+
+	return serving
+}
+
+func (h HealthChecker) setStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	h.health.SetServingStatus("", status)
+
+	for _, service := range h.services {
+		h.health.SetServingStatus(service, status)
+	}
+}
+
+// HealthHandler serves /healthz, which succeeds while the process is up, and /readyz,
+// which succeeds only while health reports the server as SERVING.
+func HealthHandler(health *health.Server) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := health.Check(r.Context(), &healthpb.HealthCheckRequest{})
+		if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok\n"))
+	})
+
+	return mux
+}
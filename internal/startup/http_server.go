@@ -0,0 +1,67 @@
+package startup
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// HttpServer serves an http.Handler next to the gRPC server.
+type HttpServer struct {
+	logger     zerolog.Logger
+	httpServer *http.Server
+}
+
+func NewHttpServer(logger zerolog.Logger, handler http.Handler) HttpServer {
+	return NewTlsHttpServer(logger, handler, nil)
+}
+
+// NewTlsHttpServer constructs an HttpServer that serves HTTPS with tlsConfig, or plain
+// HTTP if tlsConfig is nil.
+func NewTlsHttpServer(logger zerolog.Logger, handler http.Handler, tlsConfig *tls.Config) HttpServer {
+	return HttpServer{logger, &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}}
+}
+
+func (s HttpServer) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	if s.httpServer.TLSConfig != nil {
+		listener = tls.NewListener(listener, s.httpServer.TLSConfig)
+	}
+
+	s.logger.Info().
+		Str("transport", "http").
+		Str("addr", addr).
+		Bool("tls", s.httpServer.TLSConfig != nil).
+		Msg("listening")
+
+	err = s.httpServer.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func (s HttpServer) Stop() {
+	s.logger.Info().
+		Str("transport", "http").
+		Msg("stopping")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s.httpServer.Shutdown(ctx)
+}
@@ -0,0 +1,147 @@
+package startup
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/jukeizu/selection/internal/requestid"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Interceptors returns the unary and stream interceptor chains for a server. From the
+// outside in, they assign request IDs, log calls at the level levels sets for them,
+// record metrics, check API keys with authorizer unless it is nil, and recover from
+// panics, so a panicking handler fails its call with Internal and the failure is still
+// logged and counted.
+func Interceptors(logger zerolog.Logger, levels MethodLevels, authorizer *Authorizer) []grpc.ServerOption {
+	stream := []grpc.StreamServerInterceptor{
+		requestIdStreamInterceptor,
+		loggingStreamInterceptor(logger, levels),
+		metricsStreamInterceptor,
+	}
+
+	if authorizer != nil {
+		stream = append(stream, authorizer.streamInterceptor)
+	}
+
+	stream = append(stream, recoveryStreamInterceptor(logger))
+
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(UnaryInterceptor(logger, levels, authorizer)),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+}
+
+// UnaryInterceptor returns the unary chain of Interceptors as a single interceptor, so
+// that calls arriving some other way than over gRPC can be put through it too.
+func UnaryInterceptor(logger zerolog.Logger, levels MethodLevels, authorizer *Authorizer) grpc.UnaryServerInterceptor {
+	unary := []grpc.UnaryServerInterceptor{
+		requestIdUnaryInterceptor,
+		loggingUnaryInterceptor(logger, levels),
+		metricsUnaryInterceptor,
+	}
+
+	if authorizer != nil {
+		unary = append(unary, authorizer.unaryInterceptor)
+	}
+
+	unary = append(unary, recoveryUnaryInterceptor(logger))
+
+	return chainUnary(unary)
+}
+
+// chainUnary combines interceptors into one, with the first as the outermost.
+func chainUnary(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return callUnary(interceptors, ctx, req, info, handler)
+	}
+}
+
+func callUnary(interceptors []grpc.UnaryServerInterceptor, ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if len(interceptors) == 0 {
+		return handler(ctx, req)
+	}
+
+	return interceptors[0](ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return callUnary(interceptors[1:], ctx, req, info, handler)
+	})
+}
+
+// serverStream replaces the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func requestIdUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withRequestId(ctx), req)
+}
+
+func requestIdStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, serverStream{ss, withRequestId(ss.Context())})
+}
+
+// withRequestId returns a copy of ctx carrying the request ID the caller sent, or a new
+// one if it sent none, and returns the ID to the caller as a response header.
+func withRequestId(ctx context.Context) context.Context {
+	id := ""
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok && len(md.Get(requestid.MetadataKey)) > 0 {
+		id = md.Get(requestid.MetadataKey)[0]
+	}
+
+	if id == "" {
+		id = xid.New().String()
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(requestid.MetadataKey, id))
+
+	return requestid.NewContext(ctx, id)
+}
+
+func recoveryUnaryInterceptor(logger zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ctx, logger, info.FullMethod, r)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+func recoveryStreamInterceptor(logger zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ss.Context(), logger, info.FullMethod, r)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// recovered logs a panic with its stack and returns the error to fail the call with.
+func recovered(ctx context.Context, logger zerolog.Logger, method string, r interface{}) error {
+	logger = requestid.Logger(ctx, logger)
+
+	logger.Error().
+		Str("method", method).
+		Interface("panic", r).
+		Str("stack", string(debug.Stack())).
+		Msg("recovered from panic")
+
+	return status.Error(codes.Internal, "internal error")
+}
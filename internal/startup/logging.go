@@ -2,34 +2,99 @@ package startup
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/jukeizu/selection/internal/requestid"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
 )
 
-func LoggingInterceptor(logger zerolog.Logger) grpc.ServerOption {
-	return grpc.UnaryInterceptor(makeLoggingInterceptor(logger))
+// MethodLevels sets the level successful calls are logged at, by method. Keys are
+// either full method names such as /selection.v1.SelectionService/QuerySelection or
+// just the method name. Methods not listed are logged at info. Failed calls are
+// always logged at error.
+type MethodLevels map[string]zerolog.Level
+
+// ParseMethodLevels parses a comma separated list of method=level pairs, such as
+// QuerySelection=debug,GetSelection=warn.
+func ParseMethodLevels(s string) (MethodLevels, error) {
+	levels := MethodLevels{}
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("method log level %q is not of the form method=level", pair)
+		}
+
+		level, err := zerolog.ParseLevel(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("method log level %q: %s", pair, err)
+		}
+
+		levels[parts[0]] = level
+	}
+
+	return levels, nil
+}
+
+func (l MethodLevels) level(fullMethod string) zerolog.Level {
+	if level, ok := l[fullMethod]; ok {
+		return level
+	}
+
+	if level, ok := l[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]; ok {
+		return level
+	}
+
+	return zerolog.InfoLevel
 }
 
-func makeLoggingInterceptor(logger zerolog.Logger) grpc.UnaryServerInterceptor {
+func loggingUnaryInterceptor(logger zerolog.Logger, levels MethodLevels) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		begin := time.Now()
 
 		resp, err := handler(ctx, req)
 
-		logger := logger.With().
-			Str("method", info.FullMethod).
-			Str("took", time.Since(begin).String()).
-			Logger()
+		logCall(ctx, logger, levels, info.FullMethod, begin, err)
 
-		if err != nil {
-			logger.Error().Err(err).Msg("")
-			return resp, err
-		}
+		return resp, err
+	}
+}
 
-		logger.Info().Msg("called")
+func loggingStreamInterceptor(logger zerolog.Logger, levels MethodLevels) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		begin := time.Now()
 
-		return resp, err
+		err := handler(srv, ss)
+
+		logCall(ss.Context(), logger, levels, info.FullMethod, begin, err)
+
+		return err
 	}
 }
+
+func logCall(ctx context.Context, logger zerolog.Logger, levels MethodLevels, method string, begin time.Time, err error) {
+	logContext := requestid.Logger(ctx, logger).With().
+		Str("method", method).
+		Str("took", time.Since(begin).String())
+
+	if subject := ClientSubject(ctx); subject != "" {
+		logContext = logContext.Str("clientSubject", subject)
+	}
+
+	logger = logContext.Logger()
+
+	if err != nil {
+		logger.Error().Err(err).Msg("")
+		return
+	}
+
+	logger.WithLevel(levels.level(method)).Msg("called")
+}
@@ -0,0 +1,49 @@
+package startup
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "selection_grpc_server_handling_seconds",
+		Help:    "Time taken to handle RPCs.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	rpcHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "selection_grpc_server_handled_total",
+		Help: "RPCs handled, by status code.",
+	}, []string{"method", "code"})
+)
+
+func metricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	begin := time.Now()
+
+	resp, err := handler(ctx, req)
+
+	observeCall(info.FullMethod, begin, err)
+
+	return resp, err
+}
+
+func metricsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	begin := time.Now()
+
+	err := handler(srv, ss)
+
+	observeCall(info.FullMethod, begin, err)
+
+	return err
+}
+
+func observeCall(method string, begin time.Time, err error) {
+	rpcDuration.WithLabelValues(method).Observe(time.Since(begin).Seconds())
+	rpcHandled.WithLabelValues(method, status.Code(err).String()).Inc()
+}
@@ -5,15 +5,19 @@ import (
 
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
 )
 
 type Server struct {
 	logger     zerolog.Logger
 	grpcServer *grpc.Server
+	health     *health.Server
 }
 
-func NewServer(logger zerolog.Logger, grpcServer *grpc.Server) Server {
-	return Server{logger, grpcServer}
+// NewServer constructs a new Server. health, if not nil, is switched to NOT_SERVING
+// when the server starts draining in Stop.
+func NewServer(logger zerolog.Logger, grpcServer *grpc.Server, health *health.Server) Server {
+	return Server{logger, grpcServer, health}
 }
 
 func (s Server) Start(addr string) error {
@@ -39,5 +43,9 @@ func (s Server) Stop() {
 		Str("transport", "grpc").
 		Msg("stopping")
 
+	if s.health != nil {
+		s.health.Shutdown()
+	}
+
 	s.grpcServer.GracefulStop()
 }
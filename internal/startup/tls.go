@@ -0,0 +1,169 @@
+package startup
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// NewTlsConfig constructs a server tls.Config that serves the certificate in certFile
+// and keyFile. If clientCaFile is set, clients must present a certificate signed by one
+// of the CAs in it. The files are checked for changes on every handshake and reloaded
+// when they change, so certificates can be rotated without a restart. A file that
+// fails to load is logged and the previous certificate stays in use.
+func NewTlsConfig(logger zerolog.Logger, certFile, keyFile, clientCaFile string) (*tls.Config, error) {
+	r := &certReloader{
+		logger:       logger,
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCaFile: clientCaFile,
+	}
+
+	err := r.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.config(), nil
+		},
+	}, nil
+}
+
+// certReloader keeps the server certificate and client CAs in step with their files.
+type certReloader struct {
+	logger       zerolog.Logger
+	certFile     string
+	keyFile      string
+	clientCaFile string
+
+	mu       sync.Mutex
+	modified time.Time
+	current  *tls.Config
+}
+
+// config returns the tls.Config for the files as they are now.
+func (r *certReloader) config() *tls.Config {
+	err := r.reload()
+	if err != nil {
+		r.logger.Error().Err(err).Msg("could not reload tls certificates, keeping the previous ones")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.current
+}
+
+// reload loads the files again if any of them has changed since they were last loaded.
+func (r *certReloader) reload() error {
+	modified, err := latestModTime(r.certFile, r.keyFile, r.clientCaFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil && !modified.After(r.modified) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	// The config replaces the one the server set up, so it has to offer HTTP/2 itself.
+	// HTTP/1.1 is offered too for JSON clients of the HTTP gateway.
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if r.clientCaFile != "" {
+		pem, err := os.ReadFile(r.clientCaFile)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.clientCaFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if r.current != nil {
+		r.logger.Info().Msg("reloaded tls certificates")
+	}
+
+	r.current = config
+	r.modified = modified
+
+	return nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	latest := time.Time{}
+
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// ClientSubject returns the subject of the verified certificate the client of the call
+// in ctx authenticated with, or "" if it did not present one.
+func ClientSubject(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) < 1 || len(tlsInfo.State.VerifiedChains[0]) < 1 {
+		return ""
+	}
+
+	return tlsInfo.State.VerifiedChains[0][0].Subject.String()
+}
+
+// ValidateTlsFlags checks that the tls files are configured consistently.
+func ValidateTlsFlags(certFile, keyFile, clientCaFile string) error {
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("a tls certificate and key must be set together")
+	}
+
+	if clientCaFile != "" && certFile == "" {
+		return errors.New("a client CA needs a tls certificate and key")
+	}
+
+	return nil
+}
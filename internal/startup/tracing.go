@@ -0,0 +1,108 @@
+package startup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// Trace exporters accepted by NewTracerProvider.
+const (
+	TraceExporterNone   = ""
+	TraceExporterStdout = "stdout"
+	TraceExporterFile   = "file"
+	TraceExporterOtlp   = "otlp"
+)
+
+// NewTracerProvider constructs a TracerProvider that sends spans to exporter and
+// installs it, along with W3C trace context and baggage propagation, as the global
+// TracerProvider. The file exporter writes to path, and the otlp exporter is configured
+// through the standard OTEL_EXPORTER_OTLP_* environment variables. Spans are sampled
+// whenever the caller's span was, and always for calls that arrive without one.
+//
+// With TraceExporterNone it returns nil and tracing stays disabled. Shutdown flushes
+// any buffered spans.
+func NewTracerProvider(exporter, path, version string) (*sdktrace.TracerProvider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+
+	switch exporter {
+	case TraceExporterNone:
+		return nil, nil
+	case TraceExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case TraceExporterFile:
+		spanExporter, err = newFileExporter(path)
+	case TraceExporterOtlp:
+		spanExporter, err = otlptracegrpc.New(context.Background())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("selection"),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tracerProvider)
+
+	return tracerProvider, nil
+}
+
+func newFileExporter(path string) (sdktrace.SpanExporter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("the file trace exporter needs a file path")
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return fileExporter{exporter, f}, nil
+}
+
+// fileExporter closes its file once the exporter has shut down.
+type fileExporter struct {
+	*stdouttrace.Exporter
+	file io.Closer
+}
+
+func (e fileExporter) Shutdown(ctx context.Context) error {
+	err := e.Exporter.Shutdown(ctx)
+
+	closeErr := e.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -1,6 +1,13 @@
 package selection
 
-import "github.com/rs/zerolog"
+import (
+	"context"
+
+	"github.com/jukeizu/selection/internal/requestid"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
 
 // Batcher handles splitting a single slice of objects into batches of objects with limited length.
 type Batcher struct {
@@ -13,7 +20,15 @@ func NewBatcher(logger zerolog.Logger) Batcher {
 }
 
 // CreateBatches distributes batch options into batches of size batchSize.
-func (b Batcher) CreateBatches(batchOptions []BatchOption, batchSize int) []Batch {
+func (b Batcher) CreateBatches(ctx context.Context, batchOptions []BatchOption, batchSize int) []Batch {
+	b.logger = requestid.Logger(ctx, b.logger)
+
+	_, span := tracer.Start(ctx, "Batcher.CreateBatches", trace.WithAttributes(
+		attribute.Int("selection.batch_size", batchSize),
+		attribute.Int("selection.num_batch_options", len(batchOptions)),
+	))
+	defer span.End()
+
 	if batchSize == 0 {
 		b.logger.Info().Msg("batchSize is zero. No batches will be created")
 		return []Batch{}
@@ -47,6 +62,9 @@ func (b Batcher) CreateBatches(batchOptions []BatchOption, batchSize int) []Batc
 		batches = append(batches, batch)
 	}
 
+	batchOptionCounts.Observe(float64(numBatchOptions))
+	batchCounts.Observe(float64(len(batches)))
+
 	b.logger.Info().
 		Int("batchSize", batchSize).
 		Int("numCreatedBatches", len(batches)).
@@ -0,0 +1,39 @@
+package selection
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+// selectionCursor marks the position of the last selection on a page. Selections are
+// listed in (Created, Id) order, so the next page starts strictly after it.
+type selectionCursor struct {
+	Created time.Time
+	Id      string
+}
+
+func (c selectionCursor) Encode() string {
+	raw := c.Created.UTC().Format(time.RFC3339Nano) + "|" + c.Id
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSelectionCursor(token string) (selectionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return selectionCursor{}, NewValidationError("Page token `%s` is not valid.", token).WithField("page_token", token)
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return selectionCursor{}, NewValidationError("Page token `%s` is not valid.", token).WithField("page_token", token)
+	}
+
+	created, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return selectionCursor{}, NewValidationError("Page token `%s` is not valid.", token).WithField("page_token", token)
+	}
+
+	return selectionCursor{Created: created, Id: parts[1]}, nil
+}
@@ -0,0 +1,140 @@
+package selection
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSelectionCursorRoundTrip(t *testing.T) {
+	created := time.Date(2026, 10, 18, 12, 4, 5, 123456789, time.FixedZone("test", -5*60*60))
+	cursor := selectionCursor{Created: created, Id: "c5rq|id"}
+
+	decoded, err := decodeSelectionCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("decodeSelectionCursor returned error: %s", err)
+	}
+
+	if !decoded.Created.Equal(created) || decoded.Id != cursor.Id {
+		t.Errorf("decoded %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestDecodeSelectionCursorInvalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not base64", "not a token!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("2026-10-18T12:00:00Z|a"))},
+		{"no separator", encode("2026-10-18T12:00:00Z")},
+		{"no id", encode("2026-10-18T12:00:00Z|")},
+		{"bad time", encode("yesterday|a")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := decodeSelectionCursor(test.token)
+
+			validationErr, ok := err.(ValidationError)
+			if !ok {
+				t.Fatalf("error = %#v, want a ValidationError", err)
+			}
+
+			if validationErr.Field != "page_token" || validationErr.Token != test.token {
+				t.Errorf("field, token = %q, %q, want %q, %q", validationErr.Field, validationErr.Token, "page_token", test.token)
+			}
+		})
+	}
+}
+
+func TestListPaging(t *testing.T) {
+	tests := []struct {
+		name          string
+		numSelections int
+		pageSize      int
+		pages         []int
+	}{
+		{"partial last page", 5, 2, []int{2, 2, 1}},
+		{"exact last page", 4, 2, []int{2, 2}},
+		{"single page", 3, 5, []int{3}},
+		{"page size of one", 3, 1, []int{1, 1, 1}},
+		{"empty", 0, 2, []int{0}},
+		{"default page size", DefaultPageSize + 1, 0, []int{DefaultPageSize, 1}},
+		{"page size above maximum", MaxPageSize + 1, MaxPageSize + 1, []int{MaxPageSize, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			service := newTestService(NewMemoryRepository())
+
+			for i := 0; i < test.numSelections; i++ {
+				_, err := service.Create(ctx, CreateSelectionRequest{AppId: "app", InstanceId: "instance", UserId: strconv.Itoa(i)})
+				if err != nil {
+					t.Fatalf("Create returned error: %s", err)
+				}
+			}
+
+			// Selections of another app must not show up in any page.
+			_, err := service.Create(ctx, CreateSelectionRequest{AppId: "other", InstanceId: "instance", UserId: "0"})
+			if err != nil {
+				t.Fatalf("Create returned error: %s", err)
+			}
+
+			seen := map[string]bool{}
+			pageToken := ""
+
+			for i, want := range test.pages {
+				reply, err := service.List(ctx, ListSelectionsRequest{AppId: "app", PageSize: test.pageSize, PageToken: pageToken})
+				if err != nil {
+					t.Fatalf("page %d: List returned error: %s", i+1, err)
+				}
+
+				if len(reply.Selections) != want {
+					t.Errorf("page %d has %d selections, want %d", i+1, len(reply.Selections), want)
+				}
+
+				for _, summary := range reply.Selections {
+					if summary.AppId != "app" || seen[summary.Id] {
+						t.Errorf("page %d: unexpected selection %+v", i+1, summary)
+					}
+					seen[summary.Id] = true
+				}
+
+				last := i == len(test.pages)-1
+				if last != (reply.NextPageToken == "") {
+					t.Fatalf("page %d: next page token %q, last page %t", i+1, reply.NextPageToken, last)
+				}
+
+				pageToken = reply.NextPageToken
+			}
+
+			if len(seen) != test.numSelections {
+				t.Errorf("listed %d selections, want %d", len(seen), test.numSelections)
+			}
+		})
+	}
+}
+
+func TestListInvalidPageToken(t *testing.T) {
+	_, err := newTestService(NewMemoryRepository()).List(context.Background(), ListSelectionsRequest{PageToken: "bogus!"})
+
+	if _, ok := err.(ValidationError); !ok {
+		t.Errorf("error = %#v, want a ValidationError", err)
+	}
+}
+
+func newTestService(repository Repository) Service {
+	logger := zerolog.Nop()
+
+	return NewDefaultService(logger, repository, NewSorter(logger), NewBatcher(logger), NewTallier(logger))
+}
@@ -0,0 +1,251 @@
+package selection
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jukeizu/selection/selection/migrations"
+	sqlitemigrations "github.com/jukeizu/selection/selection/migrations/sqlite"
+	"github.com/lib/pq"
+	"github.com/shawntoffel/gossage"
+	"modernc.org/sqlite"
+)
+
+// SqliteScheme selects the SQLite Repository in NewRepository. The rest of the url is
+// the path of the database file.
+const SqliteScheme = "sqlite://"
+
+// sqliteTimeFormat is a fixed width layout so that timestamps stored as text in SQLite
+// compare in chronological order.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000"
+
+func init() {
+	sqlite.MustRegisterScalarFunction("now", 0, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format(sqliteTimeFormat), nil
+	})
+}
+
+// dialect describes what the SQL repository needs to know about a particular database.
+type dialect interface {
+	// DriverName is the database/sql driver to open connections with.
+	DriverName() string
+
+	// Migrate brings the schema of db up to date.
+	Migrate(db *sql.DB) error
+
+	// Time converts t to a query argument.
+	Time(t time.Time) interface{}
+
+	// UUID returns the placeholder for query argument n compared against a UUID column.
+	UUID(n int) string
+}
+
+// cockroachDialect talks to CockroachDB. database is created before migrating when set.
+type cockroachDialect struct {
+	database string
+}
+
+func (d cockroachDialect) DriverName() string {
+	return "postgres"
+}
+
+func (d cockroachDialect) Migrate(db *sql.DB) error {
+	if d.database != "" {
+		_, err := db.Exec(`CREATE DATABASE IF NOT EXISTS ` + pq.QuoteIdentifier(d.database))
+		if err != nil {
+			return err
+		}
+	}
+
+	return gossageMigrate(db, migrations.Cockroach)
+}
+
+func (d cockroachDialect) Time(t time.Time) interface{} {
+	return t
+}
+
+func (d cockroachDialect) UUID(n int) string {
+	return fmt.Sprintf("$%d::UUID", n)
+}
+
+// postgresDialect talks to a database over the PostgreSQL protocol, which may turn out
+// to be CockroachDB. Queries are the same for both, so the server is only told apart
+// when migrating.
+type postgresDialect struct {
+	database string
+}
+
+func (d postgresDialect) DriverName() string {
+	return "postgres"
+}
+
+// Migrate applies the migrations with the PostgreSQL variants of the statements that
+// differ from CockroachDB. Unlike CockroachDB, PostgreSQL does not create the database
+// on demand, so it must exist before migrating.
+func (d postgresDialect) Migrate(db *sql.DB) error {
+	version := ""
+
+	err := db.QueryRow(`SELECT version()`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(version, "CockroachDB") {
+		return cockroachDialect{database: d.database}.Migrate(db)
+	}
+
+	// gen_random_uuid is built in from PostgreSQL 13 and comes from pgcrypto before that.
+	_, err = db.Exec(`CREATE EXTENSION IF NOT EXISTS pgcrypto`)
+	if err != nil {
+		return err
+	}
+
+	// gossage creates its history table with CockroachDB types. Creating it up front
+	// with PostgreSQL types turns gossage's CREATE TABLE IF NOT EXISTS into a no-op.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS gossage_migration_history (
+			id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+			version TEXT UNIQUE NOT NULL,
+			applied BOOL NOT NULL DEFAULT false,
+			created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated TIMESTAMPTZ
+		)`)
+	if err != nil {
+		return err
+	}
+
+	return gossageMigrate(db, migrations.Postgres)
+}
+
+func (d postgresDialect) Time(t time.Time) interface{} {
+	return t
+}
+
+func (d postgresDialect) UUID(n int) string {
+	return fmt.Sprintf("$%d::UUID", n)
+}
+
+func gossageMigrate(db *sql.DB, d migrations.Dialect) error {
+	g, err := gossage.New(db)
+	if err != nil {
+		return err
+	}
+
+	// DropSelectionUniqueUser20261018120700 is left out until the release after the one
+	// that scoped selections to instances, when no server upserts on the old key.
+	err = g.RegisterMigrations(
+		migrations.CreateTableSelection20190415004138{},
+		migrations.CreateTableBallot20261018120000{},
+		migrations.AddRetiredToSelection20261018120100{},
+		migrations.AddExpiresToSelection20261018120200{},
+		migrations.CreateIndexSelectionExpires20261018120300{},
+		migrations.ScopeSelectionUniqueToInstance20261018120400{Dialect: d})
+	if err != nil {
+		return err
+	}
+
+	return g.Up()
+}
+
+// sqliteDialect talks to an embedded SQLite database.
+type sqliteDialect struct{}
+
+func (d sqliteDialect) DriverName() string {
+	return "sqlite"
+}
+
+// Migrate applies the SQLite migrations. gossage keeps its history in a table that only
+// CockroachDB can create, so SQLite tracks applied versions in its own history table and
+// records each one in the same transaction as the migration itself.
+func (d sqliteDialect) Migrate(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS migration_history (
+			version TEXT PRIMARY KEY NOT NULL,
+			created TIMESTAMP NOT NULL DEFAULT (now())
+		)`)
+	if err != nil {
+		return err
+	}
+
+	applied := map[string]bool{}
+
+	rows, err := db.Query(`SELECT version FROM migration_history`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		version := ""
+
+		err := rows.Scan(&version)
+		if err != nil {
+			return err
+		}
+
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	pending := []gossage.Migration{}
+	for _, m := range []gossage.Migration{
+		sqlitemigrations.CreateTableSelection20261018120500{},
+		sqlitemigrations.CreateTableBallot20261018120600{},
+	} {
+		if !applied[m.Version()] {
+			pending = append(pending, m)
+		}
+	}
+
+	sort.Sort(gossage.ByVersion(pending))
+
+	for _, m := range pending {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		err = m.Up(tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO migration_history (version) VALUES ($1)`, m.Version())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		migrationLog("completed migration %s", m.Version())
+	}
+
+	migrationLog("migrations complete")
+
+	return nil
+}
+
+func migrationLog(format string, a ...interface{}) {
+	if gossage.Logger != nil {
+		gossage.Logger(format, a...)
+	}
+}
+
+func (d sqliteDialect) Time(t time.Time) interface{} {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+func (d sqliteDialect) UUID(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
@@ -6,10 +6,69 @@ func NewValidationError(format string, a ...interface{}) ValidationError {
 	return ValidationError{Message: fmt.Sprintf(format, a...)}
 }
 
+// ValidationError is returned when a request is invalid. Field names the request field
+// at fault and Token the part of its value that was rejected, when known. Reason is a
+// short, fixed identifier of what was wrong with it, suitable as a metric label.
 type ValidationError struct {
 	Message string
+	Field   string
+	Token   string
+	Reason  string
 }
 
 func (e ValidationError) Error() string {
 	return e.Message
 }
+
+// WithField returns a copy of e that points at token within field.
+func (e ValidationError) WithField(field, token string) ValidationError {
+	e.Field = field
+	e.Token = token
+	return e
+}
+
+// WithReason returns a copy of e with reason.
+func (e ValidationError) WithReason(reason string) ValidationError {
+	e.Reason = reason
+	return e
+}
+
+func NewNotFoundError(format string, a ...interface{}) NotFoundError {
+	return NotFoundError{Message: fmt.Sprintf(format, a...)}
+}
+
+// NotFoundError is returned when a requested selection or ballot does not exist.
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+func NewFailedPreconditionError(format string, a ...interface{}) FailedPreconditionError {
+	return FailedPreconditionError{Message: fmt.Sprintf(format, a...)}
+}
+
+// FailedPreconditionError is returned when a request is valid but cannot be served in
+// the current state, such as parsing input before a selection was created.
+type FailedPreconditionError struct {
+	Message string
+}
+
+func (e FailedPreconditionError) Error() string {
+	return e.Message
+}
+
+func NewResourceExhaustedError(format string, a ...interface{}) ResourceExhaustedError {
+	return ResourceExhaustedError{Message: fmt.Sprintf(format, a...)}
+}
+
+// ResourceExhaustedError is returned when a request exceeds a limit.
+type ResourceExhaustedError struct {
+	Message string
+}
+
+func (e ResourceExhaustedError) Error() string {
+	return e.Message
+}
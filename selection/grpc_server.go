@@ -2,39 +2,136 @@ package selection
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"time"
 
 	"github.com/jukeizu/selection/api/protobuf-spec/selectionpb"
+	"github.com/jukeizu/selection/internal/requestid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
+// ErrorDomain is the domain reported in google.rpc.ErrorInfo details.
+const ErrorDomain = "selection.jukeizu"
+
 type GrpcServer struct {
+	logger  zerolog.Logger
 	service Service
 }
 
-func NewGrpcServer(service Service) GrpcServer {
-	return GrpcServer{service}
+func NewGrpcServer(logger zerolog.Logger, service Service) GrpcServer {
+	return GrpcServer{logger, service}
 }
 
 func (s GrpcServer) CreateSelection(ctx context.Context, req *selectionpb.CreateSelectionRequest) (*selectionpb.CreateSelectionResponse, error) {
-	selection, err := s.service.Create(createSelectionRequestToDto(req))
+	selection, err := s.service.Create(ctx, createSelectionRequestToDto(req))
 	if err != nil {
-		return nil, toStatusErr(err)
+		return nil, s.toStatusErr(ctx, err)
 	}
 
 	return dtoToCreateSelectionReply(selection), nil
 }
 
+func (s GrpcServer) UpdateSelection(ctx context.Context, req *selectionpb.UpdateSelectionRequest) (*selectionpb.UpdateSelectionResponse, error) {
+	reply, err := s.service.Update(ctx, UpdateSelectionRequest{
+		AppId:      req.AppId,
+		InstanceId: req.InstanceId,
+		UserId:     req.UserId,
+		ServerId:   req.ServerId,
+		BatchSize:  int(req.BatchSize),
+		SortMethod: SortMethod(req.SortMethod),
+		SortKey:    req.SortKey,
+		Options:    pbToOptions(req.Options),
+	})
+	if err != nil {
+		return nil, s.toStatusErr(ctx, err)
+	}
+
+	return &selectionpb.UpdateSelectionResponse{
+		Batches: dtoToBatches(reply.Batches),
+		Added:   dtoToBatchOptions(reply.Added),
+		Retired: dtoToBatchOptions(reply.Retired),
+	}, nil
+}
+
+func (s GrpcServer) GetSelection(ctx context.Context, req *selectionpb.GetSelectionRequest) (*selectionpb.GetSelectionResponse, error) {
+	selection, err := s.service.Get(ctx, GetSelectionRequest{
+		AppId:      req.AppId,
+		InstanceId: req.InstanceId,
+		UserId:     req.UserId,
+		ServerId:   req.ServerId,
+	})
+	if err != nil {
+		return nil, s.toStatusErr(ctx, err)
+	}
+
+	return &selectionpb.GetSelectionResponse{
+		Selection: dtoToSelection(selection),
+	}, nil
+}
+
+func (s GrpcServer) ListSelections(ctx context.Context, req *selectionpb.ListSelectionsRequest) (*selectionpb.ListSelectionsResponse, error) {
+	reply, err := s.service.List(ctx, ListSelectionsRequest{
+		AppId:         req.AppId,
+		InstanceId:    req.InstanceId,
+		UserId:        req.UserId,
+		ServerId:      req.ServerId,
+		CreatedAfter:  pbToTime(req.CreatedAfter),
+		CreatedBefore: pbToTime(req.CreatedBefore),
+		UpdatedAfter:  pbToTime(req.UpdatedAfter),
+		UpdatedBefore: pbToTime(req.UpdatedBefore),
+		PageSize:      int(req.PageSize),
+		PageToken:     req.PageToken,
+	})
+	if err != nil {
+		return nil, s.toStatusErr(ctx, err)
+	}
+
+	return &selectionpb.ListSelectionsResponse{
+		Selections:    dtoToSelectionSummaries(reply.Selections),
+		NextPageToken: reply.NextPageToken,
+	}, nil
+}
+
+func (s GrpcServer) DeleteSelection(ctx context.Context, req *selectionpb.DeleteSelectionRequest) (*selectionpb.DeleteSelectionResponse, error) {
+	reply, err := s.service.Delete(ctx, DeleteSelectionRequest{
+		AppId:      req.AppId,
+		InstanceId: req.InstanceId,
+		UserId:     req.UserId,
+		ServerId:   req.ServerId,
+		Instance:   req.Instance,
+	})
+	if err != nil {
+		return nil, s.toStatusErr(ctx, err)
+	}
+
+	return &selectionpb.DeleteSelectionResponse{
+		Deleted: reply.Deleted,
+	}, nil
+}
+
 func (s GrpcServer) ParseSelection(ctx context.Context, req *selectionpb.ParseSelectionRequest) (*selectionpb.ParseSelectionResponse, error) {
-	rankedOptions, err := s.service.Parse(ParseSelectionRequest{
+	rankedOptions, err := s.service.Parse(ctx, ParseSelectionRequest{
 		AppId:      req.AppId,
 		InstanceId: req.InstanceId,
 		UserId:     req.UserId,
 		ServerId:   req.ServerId,
 		Content:    req.Content,
+		DryRun:     req.DryRun,
 	})
 	if err != nil {
-		return nil, toStatusErr(err)
+		return nil, s.toStatusErr(ctx, err)
 	}
 
 	return &selectionpb.ParseSelectionResponse{
@@ -43,7 +140,7 @@ func (s GrpcServer) ParseSelection(ctx context.Context, req *selectionpb.ParseSe
 }
 
 func (s GrpcServer) QuerySelection(ctx context.Context, req *selectionpb.QuerySelectionRequest) (*selectionpb.QuerySelectionResponse, error) {
-	queryReply, err := s.service.Query(QuerySelectionRequest{
+	queryReply, err := s.service.Query(ctx, QuerySelectionRequest{
 		AppId:      req.AppId,
 		InstanceId: req.InstanceId,
 		UserId:     req.UserId,
@@ -51,7 +148,7 @@ func (s GrpcServer) QuerySelection(ctx context.Context, req *selectionpb.QuerySe
 		Options:    req.Options,
 	})
 	if err != nil {
-		return nil, toStatusErr(err)
+		return nil, s.toStatusErr(ctx, err)
 	}
 
 	return &selectionpb.QuerySelectionResponse{
@@ -60,6 +157,35 @@ func (s GrpcServer) QuerySelection(ctx context.Context, req *selectionpb.QuerySe
 	}, nil
 }
 
+func (s GrpcServer) GetBallot(ctx context.Context, req *selectionpb.GetBallotRequest) (*selectionpb.GetBallotResponse, error) {
+	ballot, err := s.service.Ballot(ctx, BallotRequest{
+		AppId:      req.AppId,
+		InstanceId: req.InstanceId,
+		UserId:     req.UserId,
+		ServerId:   req.ServerId,
+	})
+	if err != nil {
+		return nil, s.toStatusErr(ctx, err)
+	}
+
+	return &selectionpb.GetBallotResponse{
+		Ballot: dtoToBallot(ballot),
+	}, nil
+}
+
+func (s GrpcServer) TallySelection(ctx context.Context, req *selectionpb.TallySelectionRequest) (*selectionpb.TallySelectionResponse, error) {
+	result, err := s.service.Tally(ctx, TallyRequest{
+		AppId:      req.AppId,
+		InstanceId: req.InstanceId,
+		Method:     VotingMethod(req.Method),
+	})
+	if err != nil {
+		return nil, s.toStatusErr(ctx, err)
+	}
+
+	return dtoToTallySelectionReply(result), nil
+}
+
 func createSelectionRequestToDto(req *selectionpb.CreateSelectionRequest) CreateSelectionRequest {
 	c := CreateSelectionRequest{
 		AppId:      req.AppId,
@@ -70,44 +196,68 @@ func createSelectionRequestToDto(req *selectionpb.CreateSelectionRequest) Create
 		BatchSize:  int(req.BatchSize),
 		SortMethod: SortMethod(req.SortMethod),
 		SortKey:    req.SortKey,
+		Regenerate: req.Regenerate,
+		Ttl:        time.Duration(req.TtlSeconds) * time.Second,
+		ExpiresAt:  pbToTime(req.ExpiresAt),
 	}
 
-	for _, reqOption := range req.Options {
+	c.Options = pbToOptions(req.Options)
+
+	return c
+}
+
+func pbToOptions(reqOptions []*selectionpb.Option) []Option {
+	var options []Option
+
+	for _, reqOption := range reqOptions {
 		option := Option{
 			OptionId: reqOption.OptionId,
 			Content:  reqOption.Content,
 			Metadata: reqOption.Metadata,
 		}
 
-		c.Options = append(c.Options, option)
+		options = append(options, option)
 	}
 
-	return c
+	return options
 }
 
 func dtoToCreateSelectionReply(selectionReply SelectionReply) *selectionpb.CreateSelectionResponse {
 	reply := &selectionpb.CreateSelectionResponse{
-		Batches: []*selectionpb.Batch{},
+		Batches: dtoToBatches(selectionReply.Batches),
+		Status:  string(selectionReply.Status),
 	}
 
-	for _, dtoBatch := range selectionReply.Batches {
-		replyBatch := &selectionpb.Batch{
-			Options: []*selectionpb.BatchOption{},
+	return reply
+}
+
+func dtoToBatches(dtoBatches []Batch) []*selectionpb.Batch {
+	batches := []*selectionpb.Batch{}
+
+	for _, dtoBatch := range dtoBatches {
+		batch := &selectionpb.Batch{
+			Options: dtoToBatchOptions(dtoBatch.Options),
 		}
 
-		for _, dtoBatchOption := range dtoBatch.Options {
-			replyBatchOption := &selectionpb.BatchOption{
-				Number: int32(dtoBatchOption.Number),
-				Option: dtoToOption(dtoBatchOption.Option),
-			}
+		batches = append(batches, batch)
+	}
 
-			replyBatch.Options = append(replyBatch.Options, replyBatchOption)
+	return batches
+}
+
+func dtoToBatchOptions(dtoBatchOptions []BatchOption) []*selectionpb.BatchOption {
+	batchOptions := []*selectionpb.BatchOption{}
+
+	for _, dtoBatchOption := range dtoBatchOptions {
+		batchOption := &selectionpb.BatchOption{
+			Number: int32(dtoBatchOption.Number),
+			Option: dtoToOption(dtoBatchOption.Option),
 		}
 
-		reply.Batches = append(reply.Batches, replyBatch)
+		batchOptions = append(batchOptions, batchOption)
 	}
 
-	return reply
+	return batchOptions
 }
 
 func dtoToOption(dtoOption Option) *selectionpb.Option {
@@ -136,10 +286,272 @@ func dtoToRankedOption(dtoRankedOptions []RankedOption) []*selectionpb.RankedOpt
 	return rankedOptions
 }
 
-func toStatusErr(err error) error {
-	switch err.(type) {
+func dtoToBallot(dtoBallot Ballot) *selectionpb.Ballot {
+	ballot := &selectionpb.Ballot{
+		Id:            dtoBallot.Id,
+		AppId:         dtoBallot.AppId,
+		InstanceId:    dtoBallot.InstanceId,
+		UserId:        dtoBallot.UserId,
+		ServerId:      dtoBallot.ServerId,
+		RankedOptions: dtoToRankedOption(dtoBallot.Options),
+		Created:       timestamppb.New(dtoBallot.Created),
+		Updated:       timestamppb.New(dtoBallot.Updated),
+	}
+
+	return ballot
+}
+
+func dtoToTallySelectionReply(result TallyResult) *selectionpb.TallySelectionResponse {
+	reply := &selectionpb.TallySelectionResponse{
+		Method:     string(result.Method),
+		Rounds:     []*selectionpb.TallyRound{},
+		Scores:     dtoToOptionCounts(result.Scores),
+		Pairwise:   []*selectionpb.PairwiseCount{},
+		NumBallots: int32(result.NumBallots),
+	}
+
+	if result.Winner != nil {
+		reply.Winner = dtoToOption(*result.Winner)
+	}
+
+	for _, dtoRound := range result.Rounds {
+		round := &selectionpb.TallyRound{
+			Round:     int32(dtoRound.Round),
+			Counts:    dtoToOptionCounts(dtoRound.Counts),
+			Exhausted: int32(dtoRound.Exhausted),
+		}
+
+		if dtoRound.Eliminated != nil {
+			round.Eliminated = dtoToOption(*dtoRound.Eliminated)
+		}
+
+		reply.Rounds = append(reply.Rounds, round)
+	}
+
+	for _, dtoPairwiseCount := range result.Pairwise {
+		pairwiseCount := &selectionpb.PairwiseCount{
+			Option:  dtoToOption(dtoPairwiseCount.Option),
+			Against: dtoToOption(dtoPairwiseCount.Against),
+			Count:   int32(dtoPairwiseCount.Count),
+		}
+
+		reply.Pairwise = append(reply.Pairwise, pairwiseCount)
+	}
+
+	return reply
+}
+
+func dtoToOptionCounts(dtoOptionCounts []OptionCount) []*selectionpb.OptionCount {
+	optionCounts := []*selectionpb.OptionCount{}
+
+	for _, dtoOptionCount := range dtoOptionCounts {
+		optionCount := &selectionpb.OptionCount{
+			Option: dtoToOption(dtoOptionCount.Option),
+			Count:  int32(dtoOptionCount.Count),
+		}
+
+		optionCounts = append(optionCounts, optionCount)
+	}
+
+	return optionCounts
+}
+
+func dtoToSelection(dtoSelection Selection) *selectionpb.Selection {
+	selection := &selectionpb.Selection{
+		Id:         dtoSelection.Id,
+		AppId:      dtoSelection.AppId,
+		InstanceId: dtoSelection.InstanceId,
+		UserId:     dtoSelection.UserId,
+		ServerId:   dtoSelection.ServerId,
+		Options:    dtoToNumberedOptions(dtoSelection.Options),
+		Retired:    dtoToNumberedOptions(dtoSelection.Retired),
+		Created:    timeToPb(dtoSelection.Created),
+		Updated:    timeToPb(dtoSelection.Updated),
+		ExpiresAt:  timeToPb(dtoSelection.ExpiresAt),
+	}
+
+	return selection
+}
+
+func dtoToNumberedOptions(dtoOptions map[int]Option) map[int32]*selectionpb.Option {
+	options := map[int32]*selectionpb.Option{}
+
+	for number, dtoOption := range dtoOptions {
+		options[int32(number)] = dtoToOption(dtoOption)
+	}
+
+	return options
+}
+
+func dtoToSelectionSummaries(dtoSummaries []SelectionSummary) []*selectionpb.SelectionSummary {
+	summaries := []*selectionpb.SelectionSummary{}
+
+	for _, dtoSummary := range dtoSummaries {
+		summary := &selectionpb.SelectionSummary{
+			Id:         dtoSummary.Id,
+			AppId:      dtoSummary.AppId,
+			InstanceId: dtoSummary.InstanceId,
+			UserId:     dtoSummary.UserId,
+			ServerId:   dtoSummary.ServerId,
+			NumOptions: int32(dtoSummary.NumOptions),
+			Created:    timeToPb(dtoSummary.Created),
+			Updated:    timeToPb(dtoSummary.Updated),
+			ExpiresAt:  timeToPb(dtoSummary.ExpiresAt),
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
+
+// timeToPb converts t to a protobuf timestamp. The zero time converts to nil.
+func timeToPb(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
+
+// pbToTime converts a protobuf timestamp to a time. Nil converts to the zero time.
+func pbToTime(t *timestamppb.Timestamp) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return t.AsTime()
+}
+
+// toStatusErr converts err to a gRPC status error. Errors from the service map to their
+// matching codes. Repository errors are classified without exposing driver messages and
+// logged, as warnings when the request was at fault. Anything unrecognized is returned
+// as Internal.
+func (s GrpcServer) toStatusErr(ctx context.Context, err error) error {
+	switch e := err.(type) {
 	case ValidationError:
-		return status.Error(codes.InvalidArgument, err.Error())
+		return validationStatus(e).Err()
+	case NotFoundError:
+		return status.Error(codes.NotFound, err.Error())
+	case FailedPreconditionError:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case ResourceExhaustedError:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	code, message := repositoryErrorCode(err)
+
+	logger := requestid.Logger(ctx, s.logger)
+
+	event := logger.Error()
+	if code == codes.InvalidArgument {
+		event = logger.Warn()
+	}
+
+	event.Err(err).Str("code", code.String()).Msg("request failed")
+
+	return status.Error(code, message)
+}
+
+func validationStatus(err ValidationError) *status.Status {
+	st := status.New(codes.InvalidArgument, err.Error())
+	if err.Field == "" {
+		return st
+	}
+
+	details := []protoiface.MessageV1{
+		&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{
+				{
+					Field:       err.Field,
+					Description: err.Message,
+				},
+			},
+		},
+	}
+
+	if err.Token != "" {
+		// The specific reason lets callers tell a retired option from a mistyped one
+		// without reading the message.
+		reason := err.Reason
+		if reason == "" {
+			reason = "invalid_" + err.Field
+		}
+
+		details = append(details, &errdetails.ErrorInfo{
+			Reason: strings.ToUpper(reason),
+			Domain: ErrorDomain,
+			Metadata: map[string]string{
+				"field": err.Field,
+				"token": err.Token,
+			},
+		})
+	}
+
+	detailed, detailsErr := st.WithDetails(details...)
+	if detailsErr != nil {
+		return st
+	}
+
+	return detailed
+}
+
+// repositoryErrorCode classifies an error returned by a Repository.
+func repositoryErrorCode(err error) (codes.Code, string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return codes.NotFound, "not found"
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codes.DeadlineExceeded, "deadline exceeded"
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return codes.Canceled, "canceled"
 	}
-	return err
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return codes.Unavailable, "database unavailable"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return codes.Unavailable, "database unavailable"
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "57":
+			return codes.Unavailable, "database unavailable"
+		case "53":
+			return codes.ResourceExhausted, "database resources exhausted"
+		case "40":
+			return codes.Aborted, "transaction aborted, retry the request"
+		case "22":
+			// A value from the request that does not fit its column, such as a page
+			// token whose id is not a UUID.
+			return codes.InvalidArgument, "invalid argument"
+		}
+
+		if pqErr.Code == "23505" {
+			return codes.AlreadyExists, "already exists"
+		}
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_CANTOPEN:
+			return codes.Unavailable, "database unavailable"
+		case sqlite3.SQLITE_FULL:
+			return codes.ResourceExhausted, "database resources exhausted"
+		}
+
+		if sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+			return codes.AlreadyExists, "already exists"
+		}
+	}
+
+	return codes.Internal, "internal error"
 }
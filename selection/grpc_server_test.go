@@ -0,0 +1,103 @@
+package selection
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+func TestValidationStatusReason(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryRepository()
+	service := newTestService(repository)
+
+	err := repository.CreateSelection(ctx, Selection{
+		AppId:      "app",
+		InstanceId: "instance",
+		UserId:     "user",
+		Options:    map[int]Option{1: {OptionId: "a"}, 2: {OptionId: "b"}},
+		Retired:    map[int]Option{3: {OptionId: "c", Content: "C"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateSelection returned error: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"invalid characters", "one", "INVALID_CHARACTERS"},
+		{"invalid choice", "1-2-3", "INVALID_CHOICE"},
+		{"reversed range", "2-1", "REVERSED_RANGE"},
+		{"retired option", "3", "RETIRED_OPTION"},
+		{"unknown option", "9", "UNKNOWN_OPTION"},
+		{"unknown option in range", "4-9", "UNKNOWN_OPTION"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := service.Parse(ctx, ParseSelectionRequest{AppId: "app", InstanceId: "instance", UserId: "user", Content: test.content})
+
+			validationErr, ok := err.(ValidationError)
+			if !ok {
+				t.Fatalf("Parse error = %#v, want a ValidationError", err)
+			}
+
+			if got := testErrorInfoReason(t, validationErr); got != test.want {
+				t.Errorf("reason = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	t.Run("no reason", func(t *testing.T) {
+		_, err := decodeSelectionCursor("bogus!")
+
+		if got := testErrorInfoReason(t, err.(ValidationError)); got != "INVALID_PAGE_TOKEN" {
+			t.Errorf("reason = %q, want %q", got, "INVALID_PAGE_TOKEN")
+		}
+	})
+}
+
+func testErrorInfoReason(t *testing.T, err ValidationError) string {
+	for _, detail := range validationStatus(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+
+	t.Fatalf("status of %#v has no ErrorInfo", err)
+
+	return ""
+}
+
+func TestRepositoryErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"no rows", sql.ErrNoRows, codes.NotFound},
+		{"deadline exceeded", context.DeadlineExceeded, codes.DeadlineExceeded},
+		{"bad connection", driver.ErrBadConn, codes.Unavailable},
+		{"serialization failure", &pq.Error{Code: "40001"}, codes.Aborted},
+		{"invalid uuid", &pq.Error{Code: "22P02"}, codes.InvalidArgument},
+		{"unique violation", &pq.Error{Code: "23505"}, codes.AlreadyExists},
+		{"syntax error", &pq.Error{Code: "42601"}, codes.Internal},
+		{"other", errors.New("could not marshal options"), codes.Internal},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, _ := repositoryErrorCode(test.err); got != test.want {
+				t.Errorf("repositoryErrorCode(%v) = %s, want %s", test.err, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package selection
+
+import (
+	"context"
+	_ "embed"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jukeizu/selection/api/protobuf-spec/selectionpb"
+	"github.com/jukeizu/selection/internal/requestid"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// openApi describes the endpoints of the HTTP gateway.
+//
+//go:embed openapi.json
+var openApi []byte
+
+// maxGatewayBody caps the size of gateway request bodies.
+const maxGatewayBody = 4 << 20
+
+// HttpGateway serves CreateSelection, ParseSelection and QuerySelection as JSON
+// endpoints, using the protobuf JSON mapping for request and response bodies:
+//
+//	POST /v1/selections        CreateSelection
+//	POST /v1/selections:parse  ParseSelection
+//	POST /v1/selections:query  QuerySelection
+//	GET  /openapi.json         the OpenAPI description of the endpoints
+//
+// Calls go through interceptor like gRPC calls do, with the request headers as
+// incoming metadata, so API keys and request IDs are sent as the x-api-key and
+// x-request-id headers. Errors are the google.rpc.Status the gRPC call would have
+// failed with, under the matching HTTP status code.
+type HttpGateway struct {
+	logger      zerolog.Logger
+	server      selectionpb.SelectionServiceServer
+	interceptor grpc.UnaryServerInterceptor
+	mux         *http.ServeMux
+}
+
+// NewHttpGateway constructs a new HttpGateway that serves calls with server, through
+// interceptor unless it is nil.
+func NewHttpGateway(logger zerolog.Logger, server selectionpb.SelectionServiceServer, interceptor grpc.UnaryServerInterceptor) HttpGateway {
+	g := HttpGateway{logger, server, interceptor, http.NewServeMux()}
+
+	g.mux.HandleFunc("/v1/selections", g.handle("CreateSelection", func() proto.Message {
+		return &selectionpb.CreateSelectionRequest{}
+	}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return g.server.CreateSelection(ctx, req.(*selectionpb.CreateSelectionRequest))
+	}))
+
+	g.mux.HandleFunc("/v1/selections:parse", g.handle("ParseSelection", func() proto.Message {
+		return &selectionpb.ParseSelectionRequest{}
+	}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return g.server.ParseSelection(ctx, req.(*selectionpb.ParseSelectionRequest))
+	}))
+
+	g.mux.HandleFunc("/v1/selections:query", g.handle("QuerySelection", func() proto.Message {
+		return &selectionpb.QuerySelectionRequest{}
+	}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return g.server.QuerySelection(ctx, req.(*selectionpb.QuerySelectionRequest))
+	}))
+
+	g.mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openApi)
+	})
+
+	return g
+}
+
+func (g HttpGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// handle returns a handler that decodes a request made by newRequest from the body and
+// passes it to call as the RPC method of SelectionService.
+func (g HttpGateway) handle(method string, newRequest func() proto.Message, call grpc.UnaryHandler) http.HandlerFunc {
+	info := &grpc.UnaryServerInfo{
+		Server:     g.server,
+		FullMethod: "/selection.v1.SelectionService/" + method,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(gatewayContext(r), strings.TrimPrefix(info.FullMethod, "/"),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.RPCService("selection.v1.SelectionService"),
+				semconv.RPCMethod(method),
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPRoute(r.URL.Path),
+			))
+
+		var err error
+		defer func() {
+			span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))))
+			endSpan(span, err)
+		}()
+
+		if r.Method != http.MethodPost {
+			err = status.Error(codes.Unimplemented, "only POST is supported")
+			w.Header().Set("Allow", http.MethodPost)
+			g.write(w, http.StatusMethodNotAllowed, status.Convert(err).Proto())
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGatewayBody))
+		if err != nil {
+			err = status.Error(codes.InvalidArgument, "could not read the request body")
+			g.writeError(w, err)
+			return
+		}
+
+		req := newRequest()
+
+		err = protojson.Unmarshal(body, req)
+		if err != nil {
+			err = status.Errorf(codes.InvalidArgument, "could not decode the request body: %s", err)
+			g.writeError(w, err)
+			return
+		}
+
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			if id := requestid.FromContext(ctx); id != "" {
+				w.Header().Set(requestid.MetadataKey, id)
+			}
+
+			return call(ctx, req)
+		}
+
+		var resp interface{}
+		if g.interceptor != nil {
+			resp, err = g.interceptor(ctx, req, info, handler)
+		} else {
+			resp, err = handler(ctx, req)
+		}
+		if err != nil {
+			g.writeError(w, err)
+			return
+		}
+
+		g.write(w, http.StatusOK, resp.(proto.Message))
+	}
+}
+
+// gatewayContext returns the context of r as a gRPC server would see it: the headers as
+// incoming metadata, the trace context of a traceparent header and, for TLS
+// connections, the peer's TLS state.
+func gatewayContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for name, values := range r.Header {
+		md.Append(strings.ToLower(name), values...)
+	}
+
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	if r.TLS != nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: *r.TLS}})
+	}
+
+	return ctx
+}
+
+func (g HttpGateway) write(w http.ResponseWriter, code int, m proto.Message) {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		g.logger.Error().Err(err).Caller().Msg("could not marshal gateway response")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+func (g HttpGateway) writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+
+	g.write(w, httpStatus(st.Code()), st.Proto())
+}
+
+// httpStatus maps a gRPC status code to the HTTP status code for it.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,394 @@
+package selection
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// MemoryScheme selects the in-memory Repository in NewRepository.
+const MemoryScheme = "memory://"
+
+type selectionKey struct {
+	AppId      string
+	InstanceId string
+	UserId     string
+	ServerId   string
+}
+
+// memoryRepository is a concurrency-safe Repository that keeps everything in memory.
+// It follows the same upsert and expiry semantics as the SQL repository and is meant
+// for local development and tests. Nothing survives a restart.
+type memoryRepository struct {
+	mu         sync.RWMutex
+	selections map[selectionKey]Selection
+	ballots    map[selectionKey]Ballot
+}
+
+// NewMemoryRepository constructs an empty in-memory Repository.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		selections: map[selectionKey]Selection{},
+		ballots:    map[selectionKey]Ballot{},
+	}
+}
+
+func (r *memoryRepository) Migrate() error {
+	return nil
+}
+
+func (r *memoryRepository) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (r *memoryRepository) CreateSelection(ctx context.Context, selection Selection) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.createSelection(selection)
+
+	return nil
+}
+
+func (r *memoryRepository) ReplaceSelection(ctx context.Context, selection Selection) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.createSelection(selection)
+
+	key := selectionKey{selection.AppId, selection.InstanceId, selection.UserId, selection.ServerId}
+
+	if _, ok := r.ballots[key]; !ok {
+		return 0, nil
+	}
+
+	delete(r.ballots, key)
+
+	return 1, nil
+}
+
+// createSelection stores selection in place of any with the same key. The caller holds
+// r.mu.
+func (r *memoryRepository) createSelection(selection Selection) {
+	key := selectionKey{selection.AppId, selection.InstanceId, selection.UserId, selection.ServerId}
+
+	stored := copySelection(selection)
+
+	existing, ok := r.selections[key]
+	if ok {
+		stored.Id = existing.Id
+		stored.Created = existing.Created
+		stored.Updated = time.Now()
+	} else {
+		stored.Id = xid.New().String()
+		stored.Created = time.Now()
+		stored.Updated = time.Time{}
+	}
+
+	r.selections[key] = stored
+}
+
+func (r *memoryRepository) Selection(ctx context.Context, appId, instanceId, userId, serverId string) (Selection, error) {
+	if err := ctx.Err(); err != nil {
+		return Selection{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	selection, ok := r.selections[selectionKey{appId, instanceId, userId, serverId}]
+	if !ok || isExpired(selection, time.Now()) {
+		return Selection{}, sql.ErrNoRows
+	}
+
+	return copySelection(selection), nil
+}
+
+func (r *memoryRepository) ListSelections(ctx context.Context, filter SelectionFilter) ([]SelectionSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+
+	summaries := []SelectionSummary{}
+
+	for _, selection := range r.selections {
+		if isExpired(selection, now) || !matchesFilter(selection, filter) {
+			continue
+		}
+
+		summaries = append(summaries, SelectionSummary{
+			Id:         selection.Id,
+			AppId:      selection.AppId,
+			InstanceId: selection.InstanceId,
+			UserId:     selection.UserId,
+			ServerId:   selection.ServerId,
+			NumOptions: len(selection.Options),
+			Created:    selection.Created,
+			Updated:    selection.Updated,
+			ExpiresAt:  selection.ExpiresAt,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if !summaries[i].Created.Equal(summaries[j].Created) {
+			return summaries[i].Created.Before(summaries[j].Created)
+		}
+
+		return summaries[i].Id < summaries[j].Id
+	})
+
+	if filter.Limit > 0 && len(summaries) > filter.Limit {
+		summaries = summaries[:filter.Limit]
+	}
+
+	return summaries, nil
+}
+
+func (r *memoryRepository) DeleteSelection(ctx context.Context, appId, instanceId, userId, serverId string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := selectionKey{appId, instanceId, userId, serverId}
+
+	delete(r.ballots, key)
+
+	if _, ok := r.selections[key]; !ok {
+		return 0, nil
+	}
+
+	delete(r.selections, key)
+
+	return 1, nil
+}
+
+func (r *memoryRepository) DeleteInstance(ctx context.Context, appId, instanceId string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := int64(0)
+
+	for key := range r.selections {
+		if key.AppId == appId && key.InstanceId == instanceId {
+			delete(r.selections, key)
+			deleted++
+		}
+	}
+
+	for key := range r.ballots {
+		if key.AppId == appId && key.InstanceId == instanceId {
+			delete(r.ballots, key)
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *memoryRepository) DeleteExpiredSelections(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	deleted := int64(0)
+
+	for key, selection := range r.selections {
+		if isExpired(selection, now) {
+			delete(r.ballots, key)
+			delete(r.selections, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *memoryRepository) SaveBallot(ctx context.Context, ballot Ballot) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := selectionKey{ballot.AppId, ballot.InstanceId, ballot.UserId, ballot.ServerId}
+
+	stored := copyBallot(ballot)
+	stored.Updated = time.Now()
+
+	existing, ok := r.ballots[key]
+	if ok {
+		stored.Id = existing.Id
+		stored.Created = existing.Created
+	} else {
+		stored.Id = xid.New().String()
+		stored.Created = stored.Updated
+	}
+
+	r.ballots[key] = stored
+
+	return nil
+}
+
+func (r *memoryRepository) Ballot(ctx context.Context, appId, instanceId, userId, serverId string) (Ballot, error) {
+	if err := ctx.Err(); err != nil {
+		return Ballot{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ballot, ok := r.ballots[selectionKey{appId, instanceId, userId, serverId}]
+	if !ok {
+		return Ballot{}, sql.ErrNoRows
+	}
+
+	return copyBallot(ballot), nil
+}
+
+func (r *memoryRepository) Ballots(ctx context.Context, appId, instanceId string) ([]Ballot, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ballots := []Ballot{}
+
+	for key, ballot := range r.ballots {
+		if key.AppId == appId && key.InstanceId == instanceId {
+			ballots = append(ballots, copyBallot(ballot))
+		}
+	}
+
+	sort.Slice(ballots, func(i, j int) bool {
+		return ballots[i].Created.Before(ballots[j].Created)
+	})
+
+	return ballots, nil
+}
+
+func isExpired(selection Selection, now time.Time) bool {
+	return !selection.ExpiresAt.IsZero() && !selection.ExpiresAt.After(now)
+}
+
+func matchesFilter(selection Selection, filter SelectionFilter) bool {
+	if filter.AppId != "" && selection.AppId != filter.AppId {
+		return false
+	}
+	if filter.InstanceId != "" && selection.InstanceId != filter.InstanceId {
+		return false
+	}
+	if filter.UserId != "" && selection.UserId != filter.UserId {
+		return false
+	}
+	if filter.ServerId != "" && selection.ServerId != filter.ServerId {
+		return false
+	}
+	if !filter.CreatedAfter.IsZero() && selection.Created.Before(filter.CreatedAfter) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !selection.Created.Before(filter.CreatedBefore) {
+		return false
+	}
+
+	updated := selection.Updated
+	if updated.IsZero() {
+		updated = selection.Created
+	}
+
+	if !filter.UpdatedAfter.IsZero() && updated.Before(filter.UpdatedAfter) {
+		return false
+	}
+	if !filter.UpdatedBefore.IsZero() && !updated.Before(filter.UpdatedBefore) {
+		return false
+	}
+
+	if filter.AfterId != "" {
+		if selection.Created.Before(filter.AfterCreated) {
+			return false
+		}
+		if selection.Created.Equal(filter.AfterCreated) && selection.Id <= filter.AfterId {
+			return false
+		}
+	}
+
+	return true
+}
+
+func copySelection(selection Selection) Selection {
+	selection.Options = copyOptions(selection.Options)
+	selection.Retired = copyOptions(selection.Retired)
+
+	return selection
+}
+
+func copyOptions(options map[int]Option) map[int]Option {
+	if options == nil {
+		return nil
+	}
+
+	copied := make(map[int]Option, len(options))
+	for number, option := range options {
+		copied[number] = copyOption(option)
+	}
+
+	return copied
+}
+
+func copyOption(option Option) Option {
+	if option.Metadata == nil {
+		return option
+	}
+
+	metadata := make(map[string]string, len(option.Metadata))
+	for k, v := range option.Metadata {
+		metadata[k] = v
+	}
+	option.Metadata = metadata
+
+	return option
+}
+
+func copyBallot(ballot Ballot) Ballot {
+	if ballot.Options == nil {
+		return ballot
+	}
+
+	options := make([]RankedOption, len(ballot.Options))
+	for i, rankedOption := range ballot.Options {
+		rankedOption.Option = copyOption(rankedOption.Option)
+		options[i] = rankedOption
+	}
+	ballot.Options = options
+
+	return ballot
+}
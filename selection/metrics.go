@@ -0,0 +1,154 @@
+package selection
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	repositoryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "selection_repository_query_seconds",
+		Help:    "Time taken by repository calls, retries counted separately.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	repositoryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "selection_repository_errors_total",
+		Help: "Repository calls that failed, not counting rows that were not found.",
+	}, []string{"method"})
+
+	repositoryRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "selection_repository_retries_total",
+		Help: "Repository calls repeated after a retryable error.",
+	}, []string{"method"})
+
+	sortStrategies = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "selection_sorts_total",
+		Help: "Batch option sorts, by the strategy used.",
+	}, []string{"strategy"})
+
+	batchOptionCounts = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "selection_batch_options",
+		Help:    "Options split into batches per request.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	})
+
+	batchCounts = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "selection_batches",
+		Help:    "Batches created per request.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	parseFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "selection_parse_failures_total",
+		Help: "Parse requests rejected, by reason.",
+	}, []string{"reason"})
+)
+
+// Reasons for rejecting input to Parse, as reported by ValidationError.Reason, upper-cased
+// in the ErrorInfo of the grpc status, and the selection_parse_failures_total metric.
+const (
+	ReasonInvalidCharacters = "invalid_characters"
+	ReasonInvalidChoice     = "invalid_choice"
+	ReasonReversedRange     = "reversed_range"
+	ReasonRetiredOption     = "retired_option"
+	ReasonUnknownOption     = "unknown_option"
+	ReasonTooManyChoices    = "too_many_choices"
+	ReasonNoSelection       = "no_selection"
+)
+
+// metricsRepository records the latency and errors of calls to another Repository.
+type metricsRepository struct {
+	repository Repository
+}
+
+// NewMetricsRepository wraps repository so that the latency and errors of every call are
+// recorded as Prometheus metrics.
+func NewMetricsRepository(repository Repository) Repository {
+	return metricsRepository{repository}
+}
+
+func (r metricsRepository) Migrate() error {
+	return r.repository.Migrate()
+}
+
+func (r metricsRepository) Ping(ctx context.Context) error {
+	begin := time.Now()
+	err := r.repository.Ping(ctx)
+	return r.observe("Ping", begin, err)
+}
+
+func (r metricsRepository) CreateSelection(ctx context.Context, selection Selection) error {
+	begin := time.Now()
+	err := r.repository.CreateSelection(ctx, selection)
+	return r.observe("CreateSelection", begin, err)
+}
+
+func (r metricsRepository) ReplaceSelection(ctx context.Context, selection Selection) (int64, error) {
+	begin := time.Now()
+	deleted, err := r.repository.ReplaceSelection(ctx, selection)
+	return deleted, r.observe("ReplaceSelection", begin, err)
+}
+
+func (r metricsRepository) Selection(ctx context.Context, appId, instanceId, userId, serverId string) (Selection, error) {
+	begin := time.Now()
+	selection, err := r.repository.Selection(ctx, appId, instanceId, userId, serverId)
+	return selection, r.observe("Selection", begin, err)
+}
+
+func (r metricsRepository) ListSelections(ctx context.Context, filter SelectionFilter) ([]SelectionSummary, error) {
+	begin := time.Now()
+	summaries, err := r.repository.ListSelections(ctx, filter)
+	return summaries, r.observe("ListSelections", begin, err)
+}
+
+func (r metricsRepository) DeleteSelection(ctx context.Context, appId, instanceId, userId, serverId string) (int64, error) {
+	begin := time.Now()
+	deleted, err := r.repository.DeleteSelection(ctx, appId, instanceId, userId, serverId)
+	return deleted, r.observe("DeleteSelection", begin, err)
+}
+
+func (r metricsRepository) DeleteInstance(ctx context.Context, appId, instanceId string) (int64, error) {
+	begin := time.Now()
+	deleted, err := r.repository.DeleteInstance(ctx, appId, instanceId)
+	return deleted, r.observe("DeleteInstance", begin, err)
+}
+
+func (r metricsRepository) DeleteExpiredSelections(ctx context.Context) (int64, error) {
+	begin := time.Now()
+	deleted, err := r.repository.DeleteExpiredSelections(ctx)
+	return deleted, r.observe("DeleteExpiredSelections", begin, err)
+}
+
+func (r metricsRepository) SaveBallot(ctx context.Context, ballot Ballot) error {
+	begin := time.Now()
+	err := r.repository.SaveBallot(ctx, ballot)
+	return r.observe("SaveBallot", begin, err)
+}
+
+func (r metricsRepository) Ballot(ctx context.Context, appId, instanceId, userId, serverId string) (Ballot, error) {
+	begin := time.Now()
+	ballot, err := r.repository.Ballot(ctx, appId, instanceId, userId, serverId)
+	return ballot, r.observe("Ballot", begin, err)
+}
+
+func (r metricsRepository) Ballots(ctx context.Context, appId, instanceId string) ([]Ballot, error) {
+	begin := time.Now()
+	ballots, err := r.repository.Ballots(ctx, appId, instanceId)
+	return ballots, r.observe("Ballots", begin, err)
+}
+
+// observe records a call to method that began at begin and returned err, and returns err.
+func (r metricsRepository) observe(method string, begin time.Time, err error) error {
+	repositoryDuration.WithLabelValues(method).Observe(time.Since(begin).Seconds())
+
+	if err != nil && err != sql.ErrNoRows {
+		repositoryErrors.WithLabelValues(method).Inc()
+	}
+
+	return err
+}
@@ -14,10 +14,10 @@ func (m CreateTableSelection20190415004138) Up(tx *sql.Tx) error {
 	_, err := tx.Exec(`
 		CREATE TABLE IF NOT EXISTS selection (
 			id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
-			appId STRING NOT NULL DEFAULT '',
-			instanceId STRING NOT NULL DEFAULT '',
-			userId STRING NOT NULL DEFAULT '',
-			serverId STRING NOT NULL DEFAULT '',
+			appId TEXT NOT NULL DEFAULT '',
+			instanceId TEXT NOT NULL DEFAULT '',
+			userId TEXT NOT NULL DEFAULT '',
+			serverId TEXT NOT NULL DEFAULT '',
 			options JSONB NOT NULL,
 			created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
 			updated TIMESTAMPTZ,
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+type CreateTableBallot20261018120000 struct{}
+
+func (m CreateTableBallot20261018120000) Version() string {
+	return "20261018120000_CreateTableBallot"
+}
+
+func (m CreateTableBallot20261018120000) Up(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS ballot (
+			id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+			appId TEXT NOT NULL DEFAULT '',
+			instanceId TEXT NOT NULL DEFAULT '',
+			userId TEXT NOT NULL DEFAULT '',
+			serverId TEXT NOT NULL DEFAULT '',
+			options JSONB NOT NULL,
+			created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			UNIQUE (appId, instanceId, userId, serverId)
+		)`)
+
+	return err
+}
+
+func (m CreateTableBallot20261018120000) Down(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE ballot`)
+	return err
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+type AddRetiredToSelection20261018120100 struct{}
+
+func (m AddRetiredToSelection20261018120100) Version() string {
+	return "20261018120100_AddRetiredToSelection"
+}
+
+func (m AddRetiredToSelection20261018120100) Up(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE selection ADD COLUMN IF NOT EXISTS retired JSONB NOT NULL DEFAULT '{}'`)
+	return err
+}
+
+func (m AddRetiredToSelection20261018120100) Down(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE selection DROP COLUMN retired`)
+	return err
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+type AddExpiresToSelection20261018120200 struct{}
+
+func (m AddExpiresToSelection20261018120200) Version() string {
+	return "20261018120200_AddExpiresToSelection"
+}
+
+func (m AddExpiresToSelection20261018120200) Up(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE selection ADD COLUMN IF NOT EXISTS expires TIMESTAMPTZ`)
+	return err
+}
+
+func (m AddExpiresToSelection20261018120200) Down(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE selection DROP COLUMN expires`)
+	return err
+}
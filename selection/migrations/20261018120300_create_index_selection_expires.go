@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+type CreateIndexSelectionExpires20261018120300 struct{}
+
+func (m CreateIndexSelectionExpires20261018120300) Version() string {
+	return "20261018120300_CreateIndexSelectionExpires"
+}
+
+func (m CreateIndexSelectionExpires20261018120300) Up(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS selection_expires_idx ON selection (expires)`)
+	return err
+}
+
+func (m CreateIndexSelectionExpires20261018120300) Down(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP INDEX IF EXISTS selection_expires_idx`)
+	return err
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// ScopeSelectionUniqueToInstance20261018120400 adds a unique key on (appId, instanceId,
+// userId, serverId), which the upserts of CreateSelection conflict on.
+//
+// The old key on (appId, userId, serverId) stays in place, so servers that still upsert
+// on it keep working while the new version rolls out. DropSelectionUniqueUser20261018120700
+// removes it once no server uses it. Existing rows are already unique on the narrower
+// key, so they satisfy the new key without being rewritten.
+type ScopeSelectionUniqueToInstance20261018120400 struct {
+	Dialect Dialect
+}
+
+func (m ScopeSelectionUniqueToInstance20261018120400) Version() string {
+	return "20261018120400_ScopeSelectionUniqueToInstance"
+}
+
+func (m ScopeSelectionUniqueToInstance20261018120400) Up(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS selection_appid_instanceid_userid_serverid_key
+		ON selection (appId, instanceId, userId, serverId)`)
+	return err
+}
+
+func (m ScopeSelectionUniqueToInstance20261018120400) Down(tx *sql.Tx) error {
+	return dropUnique(tx, m.Dialect, "selection_appid_instanceid_userid_serverid_key")
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// DropSelectionUniqueUser20261018120700 drops the unique key on (appId, userId,
+// serverId) so a user can hold selections in several instances at once.
+//
+// Servers from before ScopeSelectionUniqueToInstance20261018120400 upsert on this key
+// and fail once it is gone, so it is only registered in a release after every server
+// conflicts on the instance-scoped key. Down fails if any user holds selections in
+// more than one instance; remove those rows before migrating down.
+type DropSelectionUniqueUser20261018120700 struct {
+	Dialect Dialect
+}
+
+func (m DropSelectionUniqueUser20261018120700) Version() string {
+	return "20261018120700_DropSelectionUniqueUser"
+}
+
+func (m DropSelectionUniqueUser20261018120700) Up(tx *sql.Tx) error {
+	return dropUnique(tx, m.Dialect, "selection_appid_userid_serverid_key")
+}
+
+func (m DropSelectionUniqueUser20261018120700) Down(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS selection_appid_userid_serverid_key
+		ON selection (appId, userId, serverId)`)
+	return err
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+// Dialect identifies the database a migration runs against, for the few statements
+// whose syntax differs between CockroachDB and PostgreSQL.
+type Dialect string
+
+const (
+	Cockroach = Dialect("cockroach")
+	Postgres  = Dialect("postgres")
+)
+
+// dropUnique drops a unique constraint or index on selection. CockroachDB only drops
+// unique constraints through their index, while PostgreSQL needs the constraint dropped
+// for a constraint declared in CREATE TABLE.
+func dropUnique(tx *sql.Tx, d Dialect, name string) error {
+	if d == Postgres {
+		_, err := tx.Exec(`ALTER TABLE selection DROP CONSTRAINT IF EXISTS ` + name)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DROP INDEX IF EXISTS ` + name)
+
+		return err
+	}
+
+	_, err := tx.Exec(`DROP INDEX IF EXISTS selection@` + name + ` CASCADE`)
+
+	return err
+}
@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"database/sql"
+)
+
+type CreateTableSelection20261018120500 struct{}
+
+func (m CreateTableSelection20261018120500) Version() string {
+	return "20261018120500_CreateTableSelection"
+}
+
+func (m CreateTableSelection20261018120500) Up(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS selection (
+			id TEXT PRIMARY KEY NOT NULL DEFAULT (lower(hex(randomblob(16)))),
+			appId TEXT NOT NULL DEFAULT '',
+			instanceId TEXT NOT NULL DEFAULT '',
+			userId TEXT NOT NULL DEFAULT '',
+			serverId TEXT NOT NULL DEFAULT '',
+			options TEXT NOT NULL,
+			retired TEXT NOT NULL DEFAULT '{}',
+			expires TIMESTAMP,
+			created TIMESTAMP NOT NULL DEFAULT (now()),
+			updated TIMESTAMP,
+			UNIQUE (appId, instanceId, userId, serverId)
+		)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS selection_expires_idx ON selection (expires)`)
+
+	return err
+}
+
+func (m CreateTableSelection20261018120500) Down(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE selection`)
+	return err
+}
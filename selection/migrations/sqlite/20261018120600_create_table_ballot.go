@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"database/sql"
+)
+
+type CreateTableBallot20261018120600 struct{}
+
+func (m CreateTableBallot20261018120600) Version() string {
+	return "20261018120600_CreateTableBallot"
+}
+
+func (m CreateTableBallot20261018120600) Up(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS ballot (
+			id TEXT PRIMARY KEY NOT NULL DEFAULT (lower(hex(randomblob(16)))),
+			appId TEXT NOT NULL DEFAULT '',
+			instanceId TEXT NOT NULL DEFAULT '',
+			userId TEXT NOT NULL DEFAULT '',
+			serverId TEXT NOT NULL DEFAULT '',
+			options TEXT NOT NULL,
+			created TIMESTAMP NOT NULL DEFAULT (now()),
+			updated TIMESTAMP NOT NULL DEFAULT (now()),
+			UNIQUE (appId, instanceId, userId, serverId)
+		)`)
+
+	return err
+}
+
+func (m CreateTableBallot20261018120600) Down(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE ballot`)
+	return err
+}
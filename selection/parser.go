@@ -0,0 +1,83 @@
+package selection
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// choiceRange is an inclusive range of selection numbers along with the input token it was parsed from.
+// A single number is a range where Start and End are equal.
+type choiceRange struct {
+	Start int
+	End   int
+	Token string
+}
+
+// choiceParser parses selection input such as "1 3-5, 8..9" into the ranges it refers to.
+//
+// Input is a list of items separated by whitespace and/or commas. Each item is either
+// a single number or an inclusive range written as `a-b` or `a..b`.
+type choiceParser struct {
+	validationRegex *regexp.Regexp
+	rangeSpaceRegex *regexp.Regexp
+	itemRegex       *regexp.Regexp
+}
+
+func newChoiceParser() choiceParser {
+	return choiceParser{
+		validationRegex: regexp.MustCompile(`^[\d\s,.\-]+$`),
+		rangeSpaceRegex: regexp.MustCompile(`\s*(-|\.\.)\s*`),
+		itemRegex:       regexp.MustCompile(`^(\d+)(?:(?:-|\.\.)(\d+))?$`),
+	}
+}
+
+// Parse returns the ranges in content in the order they were written.
+func (p choiceParser) Parse(content string) ([]choiceRange, error) {
+	if !p.validationRegex.MatchString(content) {
+		return nil, NewValidationError("Input may only contain numbers, ranges such as `1-5` or `1..5`, and commas.").WithField("content", content).WithReason(ReasonInvalidCharacters)
+	}
+
+	content = p.rangeSpaceRegex.ReplaceAllString(content, "$1")
+
+	items := strings.FieldsFunc(content, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	if len(items) < 1 {
+		return nil, NewValidationError("Input may only contain numbers, ranges such as `1-5` or `1..5`, and commas.").WithField("content", content).WithReason(ReasonInvalidCharacters)
+	}
+
+	choiceRanges := []choiceRange{}
+
+	for _, item := range items {
+		matches := p.itemRegex.FindStringSubmatch(item)
+		if matches == nil {
+			return nil, NewValidationError("Input `%s` is not a valid selection.", item).WithField("content", item).WithReason(ReasonInvalidChoice)
+		}
+
+		start, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, NewValidationError("Input `%s` is not a valid selection.", item).WithField("content", item).WithReason(ReasonInvalidChoice)
+		}
+
+		if matches[2] == "" {
+			choiceRanges = append(choiceRanges, choiceRange{Start: start, End: start, Token: item})
+			continue
+		}
+
+		end, err := strconv.Atoi(matches[2])
+		if err != nil {
+			return nil, NewValidationError("Input `%s` is not a valid selection.", item).WithField("content", item).WithReason(ReasonInvalidChoice)
+		}
+
+		if end < start {
+			return nil, NewValidationError("Range `%s` is reversed. Did you mean `%d-%d`?", item, end, start).WithField("content", item).WithReason(ReasonReversedRange)
+		}
+
+		choiceRanges = append(choiceRanges, choiceRange{Start: start, End: end, Token: item})
+	}
+
+	return choiceRanges, nil
+}
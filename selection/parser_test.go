@@ -0,0 +1,93 @@
+package selection
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChoiceParserParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []choiceRange
+	}{
+		{"single number", "1", []choiceRange{{1, 1, "1"}}},
+		{"spaces", "3 1 2", []choiceRange{{3, 3, "3"}, {1, 1, "1"}, {2, 2, "2"}}},
+		{"commas", "3,1, 2", []choiceRange{{3, 3, "3"}, {1, 1, "1"}, {2, 2, "2"}}},
+		{"dash range", "1-3", []choiceRange{{1, 3, "1-3"}}},
+		{"dot range", "1..3", []choiceRange{{1, 3, "1..3"}}},
+		{"spaced dash range", "1 - 3", []choiceRange{{1, 3, "1-3"}}},
+		{"spaced dot range", "1 .. 3", []choiceRange{{1, 3, "1..3"}}},
+		{"one sided space", "1 -3, 5.. 6", []choiceRange{{1, 3, "1-3"}, {5, 6, "5..6"}}},
+		{"single number range", "4-4", []choiceRange{{4, 4, "4-4"}}},
+		{"mixed", " 1 3-5, 8..9 ", []choiceRange{{1, 1, "1"}, {3, 5, "3-5"}, {8, 9, "8..9"}}},
+		{"repeated", "2 2", []choiceRange{{2, 2, "2"}, {2, 2, "2"}}},
+	}
+
+	parser := newChoiceParser()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parser.Parse(test.content)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", test.content, err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Parse(%q) = %v, want %v", test.content, got, test.want)
+			}
+		})
+	}
+}
+
+func TestChoiceParserParseInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		reason  string
+		token   string
+	}{
+		{"empty", "", ReasonInvalidCharacters, ""},
+		{"only separators", " , ,", ReasonInvalidCharacters, " , ,"},
+		{"letters", "1 a", ReasonInvalidCharacters, "1 a"},
+		{"negative sign", "-1", ReasonInvalidChoice, "-1"},
+		{"open range", "1-", ReasonInvalidChoice, "1-"},
+		{"double dash", "1--3", ReasonInvalidChoice, "1--3"},
+		{"three dots", "1...3", ReasonInvalidChoice, "1...3"},
+		{"single dot", "1.3", ReasonInvalidChoice, "1.3"},
+		{"chained range", "1-3-5", ReasonInvalidChoice, "1-3-5"},
+		{"overflow", "99999999999999999999", ReasonInvalidChoice, "99999999999999999999"},
+		{"reversed dash range", "5-3", ReasonReversedRange, "5-3"},
+		{"reversed dot range", "2 9 .. 7", ReasonReversedRange, "9..7"},
+	}
+
+	parser := newChoiceParser()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parser.Parse(test.content)
+
+			validationErr, ok := err.(ValidationError)
+			if !ok {
+				t.Fatalf("Parse(%q) error = %#v, want a ValidationError", test.content, err)
+			}
+
+			if validationErr.Reason != test.reason {
+				t.Errorf("Parse(%q) reason = %q, want %q", test.content, validationErr.Reason, test.reason)
+			}
+
+			if validationErr.Field != "content" || validationErr.Token != test.token {
+				t.Errorf("Parse(%q) field, token = %q, %q, want %q, %q", test.content, validationErr.Field, validationErr.Token, "content", test.token)
+			}
+		})
+	}
+}
+
+func TestChoiceParserReversedRangeMessage(t *testing.T) {
+	_, err := newChoiceParser().Parse("5-3")
+
+	want := "Range `5-3` is reversed. Did you mean `3-5`?"
+	if err == nil || err.Error() != want {
+		t.Errorf("Parse(%q) error = %v, want %q", "5-3", err, want)
+	}
+}
@@ -0,0 +1,73 @@
+package selection
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Pruner periodically removes expired selections from a Repository.
+type Pruner struct {
+	logger     zerolog.Logger
+	repository Repository
+	interval   time.Duration
+	stop       chan struct{}
+}
+
+// NewPruner constructs a new Pruner that prunes every interval.
+func NewPruner(logger zerolog.Logger, repository Repository, interval time.Duration) Pruner {
+	return Pruner{logger, repository, interval, make(chan struct{})}
+}
+
+// Start prunes expired selections every interval until Stop is called.
+func (p Pruner) Start() error {
+	p.logger.Info().
+		Str("interval", p.interval.String()).
+		Msg("starting pruner")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-p.stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.prune(ctx)
+		}
+	}
+}
+
+// Stop stops the pruner.
+func (p Pruner) Stop() {
+	p.logger.Info().Msg("stopping pruner")
+
+	close(p.stop)
+}
+
+func (p Pruner) prune(ctx context.Context) {
+	begin := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, p.interval)
+	defer cancel()
+
+	deleted, err := p.repository.DeleteExpiredSelections(ctx)
+	if err != nil {
+		p.logger.Error().Err(err).Caller().Msg("could not prune expired selections")
+		return
+	}
+
+	p.logger.Info().
+		Int64("deleted", deleted).
+		Str("took", time.Since(begin).String()).
+		Msg("pruned expired selections")
+}
@@ -1,103 +1,484 @@
 package selection
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
 
-	"github.com/jukeizu/selection/selection/migrations"
-	"github.com/shawntoffel/gossage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	DatabaseName = "selection"
+
+	// PostgresScheme and PostgresqlScheme select a PostgreSQL or CockroachDB DSN in
+	// NewRepository.
+	PostgresScheme   = "postgres://"
+	PostgresqlScheme = "postgresql://"
 )
 
 type Repository interface {
 	Migrate() error
-	CreateSelection(Selection) error
-	Selection(appId, instanceId, userId, serverId string) (Selection, error)
+	Ping(context.Context) error
+	CreateSelection(context.Context, Selection) error
+	ReplaceSelection(context.Context, Selection) (int64, error)
+	Selection(ctx context.Context, appId, instanceId, userId, serverId string) (Selection, error)
+	ListSelections(context.Context, SelectionFilter) ([]SelectionSummary, error)
+	DeleteSelection(ctx context.Context, appId, instanceId, userId, serverId string) (int64, error)
+	DeleteInstance(ctx context.Context, appId, instanceId string) (int64, error)
+	DeleteExpiredSelections(context.Context) (int64, error)
+	SaveBallot(context.Context, Ballot) error
+	Ballot(ctx context.Context, appId, instanceId, userId, serverId string) (Ballot, error)
+	Ballots(ctx context.Context, appId, instanceId string) ([]Ballot, error)
+}
+
+// PoolConfig sizes the connection pool of an SQL Repository. Zero values mean no limit,
+// except for MaxIdleConns, where zero keeps no idle connections.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// DefaultPoolConfig matches the database/sql defaults.
+var DefaultPoolConfig = PoolConfig{
+	MaxIdleConns: 2,
 }
 
 type repository struct {
-	Db *sql.DB
+	Db      *sql.DB
+	dialect dialect
 }
 
-func NewRepository(url string) (Repository, error) {
+// NewRepository constructs a Repository for url. A url of memory:// selects the in-memory
+// Repository and sqlite://path an SQLite database file. A postgres:// or postgresql://
+// DSN connects to PostgreSQL or CockroachDB with the user, password, database and
+// sslmode it names. Anything else is treated as the address of an insecure CockroachDB
+// node and connects to DatabaseName. SQL databases keep their connections in a pool
+// sized by pool.
+func NewRepository(url string, pool PoolConfig) (Repository, error) {
+	if strings.HasPrefix(url, MemoryScheme) {
+		return NewMemoryRepository(), nil
+	}
+
+	if strings.HasPrefix(url, SqliteScheme) {
+		conn := strings.TrimPrefix(url, SqliteScheme)
+		if !strings.Contains(conn, "?") {
+			conn += "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+		}
+
+		return openRepository(sqliteDialect{}, conn, pool)
+	}
+
+	if strings.HasPrefix(url, PostgresScheme) || strings.HasPrefix(url, PostgresqlScheme) {
+		dsn, err := neturl.Parse(url)
+		if err != nil {
+			// err repeats the DSN, password included, so it is not wrapped.
+			return nil, errors.New("could not parse database DSN")
+		}
+
+		return openRepository(postgresDialect{database: strings.TrimPrefix(dsn.Path, "/")}, url, pool)
+	}
+
 	conn := fmt.Sprintf("postgresql://%s/%s?sslmode=disable", url, DatabaseName)
 
-	db, err := sql.Open("postgres", conn)
+	return openRepository(cockroachDialect{database: DatabaseName}, conn, pool)
+}
+
+func openRepository(d dialect, conn string, pool PoolConfig) (Repository, error) {
+	db, err := sql.Open(d.DriverName(), conn)
 	if err != nil {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
 	r := repository{
-		Db: db,
+		Db:      db,
+		dialect: d,
 	}
 
 	return &r, nil
 }
 
 func (r *repository) Migrate() error {
-	_, err := r.Db.Exec(`CREATE DATABASE IF NOT EXISTS ` + DatabaseName)
+	return r.dialect.Migrate(r.Db)
+}
+
+// Ping checks that the database answers queries, not just that a connection is open.
+func (r *repository) Ping(ctx context.Context) error {
+	one := 0
+	return r.Db.QueryRowContext(ctx, `SELECT 1`).Scan(&one)
+}
+
+// execer runs a statement on either the database or a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (r *repository) CreateSelection(ctx context.Context, selection Selection) error {
+	return r.upsertSelection(ctx, r.Db, selection)
+}
+
+// ReplaceSelection writes selection like CreateSelection and deletes the user's ballot
+// in the same transaction, since that ballot ranks the numbering being replaced. It
+// returns the number of ballots deleted.
+func (r *repository) ReplaceSelection(ctx context.Context, selection Selection) (int64, error) {
+	q := `DELETE FROM ballot
+	WHERE appId = $1 AND instanceId = $2 AND userId = $3 AND serverId = $4`
+
+	tx, err := r.Db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	g, err := gossage.New(r.Db)
+	err = r.upsertSelection(ctx, tx, selection)
 	if err != nil {
-		return err
+		tx.Rollback()
+		return 0, err
 	}
 
-	err = g.RegisterMigrations(
-		migrations.CreateTableSelection20190415004138{})
+	result, err := tx.ExecContext(ctx, q, selection.AppId, selection.InstanceId, selection.UserId, selection.ServerId)
 	if err != nil {
-		return err
+		tx.Rollback()
+		return 0, err
 	}
 
-	return g.Up()
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
 }
 
-func (r *repository) CreateSelection(selection Selection) error {
-	q := `INSERT INTO selection (appId, instanceId, userId, serverId, options)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (appId, userId, serverId)
-		DO UPDATE SET instanceId = excluded.instanceId, options = excluded.options, updated = now()`
+func (r *repository) upsertSelection(ctx context.Context, exec execer, selection Selection) error {
+	q := `INSERT INTO selection (appId, instanceId, userId, serverId, options, retired, expires)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (appId, instanceId, userId, serverId)
+		DO UPDATE SET options = excluded.options, retired = excluded.retired, expires = excluded.expires, updated = now()`
 
 	options, err := json.Marshal(selection.Options)
 	if err != nil {
 		return fmt.Errorf("could not marshal options to JSON: %s", err)
 	}
 
-	_, err = r.Db.Exec(q, selection.AppId, selection.InstanceId, selection.UserId, selection.ServerId, options)
+	retired, err := json.Marshal(selection.Retired)
+	if err != nil {
+		return fmt.Errorf("could not marshal retired options to JSON: %s", err)
+	}
+
+	_, err = exec.ExecContext(ctx, q, selection.AppId, selection.InstanceId, selection.UserId, selection.ServerId, options, retired, r.nullTime(selection.ExpiresAt))
 
 	return err
 }
 
-func (r *repository) Selection(appId, instanceId, userId, serverId string) (Selection, error) {
-	q := `SELECT id, appId, instanceId, userId, serverId, options FROM selection
-	WHERE appId = $1 AND instanceId = $2 AND userId = $3 AND serverId = $4`
+func (r *repository) Selection(ctx context.Context, appId, instanceId, userId, serverId string) (Selection, error) {
+	q := `SELECT id, appId, instanceId, userId, serverId, options, retired, expires, created, updated FROM selection
+	WHERE appId = $1 AND instanceId = $2 AND userId = $3 AND serverId = $4
+	AND (expires IS NULL OR expires > now())`
 
 	selection := Selection{}
 
 	jsonOptions := []byte{}
+	jsonRetired := []byte{}
+	expires := sql.NullTime{}
+	updated := sql.NullTime{}
 
-	err := r.Db.QueryRow(q, appId, instanceId, userId, serverId).Scan(
+	err := r.Db.QueryRowContext(ctx, q, appId, instanceId, userId, serverId).Scan(
 		&selection.Id,
 		&selection.AppId,
 		&selection.InstanceId,
 		&selection.UserId,
 		&selection.ServerId,
 		&jsonOptions,
+		&jsonRetired,
+		&expires,
+		&selection.Created,
+		&updated,
 	)
 	if err != nil {
 		return Selection{}, err
 	}
 
+	selection.ExpiresAt = expires.Time
+	selection.Updated = updated.Time
+
+	_, span := tracer.Start(ctx, "unmarshal options", trace.WithAttributes(
+		attribute.Int("selection.options_bytes", len(jsonOptions)+len(jsonRetired)),
+	))
+	defer span.End()
+
 	err = json.Unmarshal(jsonOptions, &selection.Options)
 	if err != nil {
 		return Selection{}, fmt.Errorf("could not unmarshal JSON to options: %s", err)
 	}
 
+	err = json.Unmarshal(jsonRetired, &selection.Retired)
+	if err != nil {
+		return Selection{}, fmt.Errorf("could not unmarshal JSON to retired options: %s", err)
+	}
+
 	return selection, nil
 }
+
+func (r *repository) ListSelections(ctx context.Context, filter SelectionFilter) ([]SelectionSummary, error) {
+	conditions := []string{"(expires IS NULL OR expires > now())"}
+	args := []interface{}{}
+
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.AppId != "" {
+		where("appId = $%d", filter.AppId)
+	}
+	if filter.InstanceId != "" {
+		where("instanceId = $%d", filter.InstanceId)
+	}
+	if filter.UserId != "" {
+		where("userId = $%d", filter.UserId)
+	}
+	if filter.ServerId != "" {
+		where("serverId = $%d", filter.ServerId)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		where("created >= $%d", r.dialect.Time(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		where("created < $%d", r.dialect.Time(filter.CreatedBefore))
+	}
+	if !filter.UpdatedAfter.IsZero() {
+		where("COALESCE(updated, created) >= $%d", r.dialect.Time(filter.UpdatedAfter))
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		where("COALESCE(updated, created) < $%d", r.dialect.Time(filter.UpdatedBefore))
+	}
+	if filter.AfterId != "" {
+		args = append(args, r.dialect.Time(filter.AfterCreated), filter.AfterId)
+		conditions = append(conditions, fmt.Sprintf("(created, id) > ($%d, %s)", len(args)-1, r.dialect.UUID(len(args))))
+	}
+
+	args = append(args, filter.Limit)
+
+	q := fmt.Sprintf(`SELECT id, appId, instanceId, userId, serverId, options, created, updated, expires FROM selection
+	WHERE %s
+	ORDER BY created, id
+	LIMIT $%d`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := r.Db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []SelectionSummary{}
+
+	for rows.Next() {
+		summary := SelectionSummary{}
+
+		jsonOptions := []byte{}
+		updated := sql.NullTime{}
+		expires := sql.NullTime{}
+
+		err := rows.Scan(
+			&summary.Id,
+			&summary.AppId,
+			&summary.InstanceId,
+			&summary.UserId,
+			&summary.ServerId,
+			&jsonOptions,
+			&summary.Created,
+			&updated,
+			&expires,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		options := map[string]json.RawMessage{}
+
+		err = json.Unmarshal(jsonOptions, &options)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal JSON to options: %s", err)
+		}
+
+		summary.NumOptions = len(options)
+		summary.Updated = updated.Time
+		summary.ExpiresAt = expires.Time
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, rows.Err()
+}
+
+func (r *repository) DeleteSelection(ctx context.Context, appId, instanceId, userId, serverId string) (int64, error) {
+	q := `DELETE FROM selection
+	WHERE appId = $1 AND instanceId = $2 AND userId = $3 AND serverId = $4`
+
+	ballotQ := `DELETE FROM ballot
+	WHERE appId = $1 AND instanceId = $2 AND userId = $3 AND serverId = $4`
+
+	return r.deleteSelections(ctx, q, ballotQ, appId, instanceId, userId, serverId)
+}
+
+func (r *repository) DeleteInstance(ctx context.Context, appId, instanceId string) (int64, error) {
+	q := `DELETE FROM selection WHERE appId = $1 AND instanceId = $2`
+
+	ballotQ := `DELETE FROM ballot WHERE appId = $1 AND instanceId = $2`
+
+	return r.deleteSelections(ctx, q, ballotQ, appId, instanceId)
+}
+
+// DeleteExpiredSelections passes the current time as an argument, so that both deletes
+// agree on which selections have expired.
+func (r *repository) DeleteExpiredSelections(ctx context.Context) (int64, error) {
+	q := `DELETE FROM selection WHERE expires <= $1`
+
+	ballotQ := `DELETE FROM ballot
+	WHERE (appId, instanceId, userId, serverId) IN (
+		SELECT appId, instanceId, userId, serverId FROM selection WHERE expires <= $1)`
+
+	return r.deleteSelections(ctx, q, ballotQ, r.dialect.Time(time.Now()))
+}
+
+// deleteSelections runs the ballot delete ballotQ and then the selection delete q, both
+// with args, in one transaction and returns the number of selections deleted. Ballots
+// go first so that ballotQ can still find the selections they belong to.
+func (r *repository) deleteSelections(ctx context.Context, q, ballotQ string, args ...interface{}) (int64, error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, ballotQ, args...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, q, args...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
+}
+
+func (r *repository) SaveBallot(ctx context.Context, ballot Ballot) error {
+	q := `INSERT INTO ballot (appId, instanceId, userId, serverId, options)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (appId, instanceId, userId, serverId)
+		DO UPDATE SET options = excluded.options, updated = now()`
+
+	options, err := json.Marshal(ballot.Options)
+	if err != nil {
+		return fmt.Errorf("could not marshal ranked options to JSON: %s", err)
+	}
+
+	_, err = r.Db.ExecContext(ctx, q, ballot.AppId, ballot.InstanceId, ballot.UserId, ballot.ServerId, options)
+
+	return err
+}
+
+func (r *repository) Ballot(ctx context.Context, appId, instanceId, userId, serverId string) (Ballot, error) {
+	q := `SELECT id, appId, instanceId, userId, serverId, options, created, updated FROM ballot
+	WHERE appId = $1 AND instanceId = $2 AND userId = $3 AND serverId = $4`
+
+	ballot := Ballot{}
+
+	jsonOptions := []byte{}
+
+	err := r.Db.QueryRowContext(ctx, q, appId, instanceId, userId, serverId).Scan(
+		&ballot.Id,
+		&ballot.AppId,
+		&ballot.InstanceId,
+		&ballot.UserId,
+		&ballot.ServerId,
+		&jsonOptions,
+		&ballot.Created,
+		&ballot.Updated,
+	)
+	if err != nil {
+		return Ballot{}, err
+	}
+
+	err = json.Unmarshal(jsonOptions, &ballot.Options)
+	if err != nil {
+		return Ballot{}, fmt.Errorf("could not unmarshal JSON to ranked options: %s", err)
+	}
+
+	return ballot, nil
+}
+
+func (r *repository) Ballots(ctx context.Context, appId, instanceId string) ([]Ballot, error) {
+	q := `SELECT id, appId, instanceId, userId, serverId, options, created, updated FROM ballot
+	WHERE appId = $1 AND instanceId = $2
+	ORDER BY created`
+
+	rows, err := r.Db.QueryContext(ctx, q, appId, instanceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ballots := []Ballot{}
+
+	for rows.Next() {
+		ballot := Ballot{}
+
+		jsonOptions := []byte{}
+
+		err := rows.Scan(
+			&ballot.Id,
+			&ballot.AppId,
+			&ballot.InstanceId,
+			&ballot.UserId,
+			&ballot.ServerId,
+			&jsonOptions,
+			&ballot.Created,
+			&ballot.Updated,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(jsonOptions, &ballot.Options)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal JSON to ranked options: %s", err)
+		}
+
+		ballots = append(ballots, ballot)
+	}
+
+	return ballots, rows.Err()
+}
+
+// nullTime converts t to a query argument, with the zero time as NULL.
+func (r *repository) nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return r.dialect.Time(t)
+}
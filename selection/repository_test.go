@@ -0,0 +1,184 @@
+package selection
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestSqliteRepository returns a migrated SQLite Repository in a temporary directory.
+func newTestSqliteRepository(t *testing.T) *repository {
+	r, err := NewRepository(SqliteScheme+filepath.Join(t.TempDir(), "selection.db"), DefaultPoolConfig)
+	if err != nil {
+		t.Fatalf("NewRepository returned error: %s", err)
+	}
+
+	sqliteRepository := r.(*repository)
+	t.Cleanup(func() {
+		sqliteRepository.Db.Close()
+	})
+
+	err = r.Migrate()
+	if err != nil {
+		t.Fatalf("Migrate returned error: %s", err)
+	}
+
+	return sqliteRepository
+}
+
+func TestSqliteMigrateTwice(t *testing.T) {
+	r := newTestSqliteRepository(t)
+
+	err := r.Migrate()
+	if err != nil {
+		t.Fatalf("second Migrate returned error: %s", err)
+	}
+
+	numVersions := 0
+
+	err = r.Db.QueryRow(`SELECT count(*) FROM migration_history`).Scan(&numVersions)
+	if err != nil {
+		t.Fatalf("could not count migrations: %s", err)
+	}
+	if numVersions != 2 {
+		t.Errorf("migration history has %d versions, want 2", numVersions)
+	}
+
+	err = r.Ping(context.Background())
+	if err != nil {
+		t.Errorf("Ping returned error: %s", err)
+	}
+}
+
+func TestSqliteExpiry(t *testing.T) {
+	ctx := context.Background()
+	r := newTestSqliteRepository(t)
+
+	selections := []Selection{
+		{AppId: "app", InstanceId: "instance", UserId: "expired", ExpiresAt: time.Now().Add(-time.Minute)},
+		{AppId: "app", InstanceId: "instance", UserId: "expiring", ExpiresAt: time.Now().Add(time.Hour)},
+		{AppId: "app", InstanceId: "instance", UserId: "forever"},
+	}
+
+	for _, selection := range selections {
+		err := r.CreateSelection(ctx, selection)
+		if err != nil {
+			t.Fatalf("CreateSelection returned error: %s", err)
+		}
+	}
+
+	_, err := r.Selection(ctx, "app", "instance", "expired", "")
+	if err != sql.ErrNoRows {
+		t.Errorf("Selection of an expired selection returned %v, want %v", err, sql.ErrNoRows)
+	}
+
+	expiring, err := r.Selection(ctx, "app", "instance", "expiring", "")
+	if err != nil {
+		t.Fatalf("Selection returned error: %s", err)
+	}
+	if !expiring.ExpiresAt.Equal(selections[1].ExpiresAt) {
+		t.Errorf("ExpiresAt = %s, want %s", expiring.ExpiresAt, selections[1].ExpiresAt)
+	}
+
+	summaries, err := r.ListSelections(ctx, SelectionFilter{AppId: "app", Limit: 10})
+	if err != nil {
+		t.Fatalf("ListSelections returned error: %s", err)
+	}
+
+	userIds := map[string]bool{}
+	for _, summary := range summaries {
+		userIds[summary.UserId] = true
+	}
+
+	if len(userIds) != 2 || !userIds["expiring"] || !userIds["forever"] {
+		t.Errorf("listed %v, want expiring and forever", userIds)
+	}
+}
+
+func TestSqliteDeleteExpiredSelections(t *testing.T) {
+	ctx := context.Background()
+	r := newTestSqliteRepository(t)
+
+	for userId, expiresAt := range map[string]time.Time{
+		"expired": time.Now().Add(-time.Minute),
+		"current": time.Now().Add(time.Hour),
+	} {
+		err := r.CreateSelection(ctx, Selection{AppId: "app", InstanceId: "instance", UserId: userId, ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatalf("CreateSelection returned error: %s", err)
+		}
+
+		err = r.SaveBallot(ctx, Ballot{AppId: "app", InstanceId: "instance", UserId: userId})
+		if err != nil {
+			t.Fatalf("SaveBallot returned error: %s", err)
+		}
+	}
+
+	deleted, err := r.DeleteExpiredSelections(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpiredSelections returned error: %s", err)
+	}
+	if deleted != 1 {
+		t.Errorf("deleted %d selections, want 1", deleted)
+	}
+
+	ballots, err := r.Ballots(ctx, "app", "instance")
+	if err != nil {
+		t.Fatalf("Ballots returned error: %s", err)
+	}
+	if len(ballots) != 1 || ballots[0].UserId != "current" {
+		t.Errorf("ballots = %+v, want only the ballot of the current selection", ballots)
+	}
+
+	deleted, err = r.DeleteExpiredSelections(ctx)
+	if err != nil || deleted != 0 {
+		t.Errorf("second DeleteExpiredSelections = %d, %v, want 0, nil", deleted, err)
+	}
+}
+
+func TestSqliteListPaging(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(newTestSqliteRepository(t))
+
+	const numSelections = 5
+
+	for i := 0; i < numSelections; i++ {
+		_, err := service.Create(ctx, CreateSelectionRequest{AppId: "app", InstanceId: "instance", UserId: strconv.Itoa(i)})
+		if err != nil {
+			t.Fatalf("Create returned error: %s", err)
+		}
+	}
+
+	seen := map[string]bool{}
+	pageToken := ""
+
+	for i, want := range []int{2, 2, 1} {
+		reply, err := service.List(ctx, ListSelectionsRequest{AppId: "app", PageSize: 2, PageToken: pageToken})
+		if err != nil {
+			t.Fatalf("page %d: List returned error: %s", i+1, err)
+		}
+
+		if len(reply.Selections) != want {
+			t.Errorf("page %d has %d selections, want %d", i+1, len(reply.Selections), want)
+		}
+
+		for _, summary := range reply.Selections {
+			if seen[summary.Id] {
+				t.Errorf("page %d: selection %s listed twice", i+1, summary.Id)
+			}
+			seen[summary.Id] = true
+		}
+
+		pageToken = reply.NextPageToken
+	}
+
+	if pageToken != "" {
+		t.Errorf("next page token %q after the last page, want none", pageToken)
+	}
+	if len(seen) != numSelections {
+		t.Errorf("listed %d selections, want %d", len(seen), numSelections)
+	}
+}
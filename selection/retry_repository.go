@@ -0,0 +1,278 @@
+package selection
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/jukeizu/selection/internal/requestid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// RetryPolicy bounds how often and how long a retrying Repository retries a call.
+type RetryPolicy struct {
+	// MaxAttempts is the most times a call is made, including the first. Values below
+	// one are treated as one.
+	MaxAttempts int
+
+	// BaseDelay is the backoff ceiling before the first retry. It doubles with every
+	// retry up to MaxDelay, and the actual delay is drawn at random below the ceiling.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy suits short CockroachDB transaction conflicts.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   10 * time.Millisecond,
+	MaxDelay:    time.Second,
+}
+
+// retryRepository retries calls to another Repository that fail with retryable errors,
+// such as CockroachDB serialization failures (SQLSTATE 40001) or a dropped connection.
+//
+// Every write is a single upsert or runs in one transaction, so repeating one after a
+// failure leaves the same rows behind as running it once. A delete or replace retried
+// after its first attempt committed reports zero rows deleted.
+type retryRepository struct {
+	logger     zerolog.Logger
+	repository Repository
+	policy     RetryPolicy
+}
+
+// NewRetryRepository wraps repository so that calls failing with retryable errors are
+// retried with exponential backoff and jitter according to policy.
+func NewRetryRepository(logger zerolog.Logger, repository Repository, policy RetryPolicy) Repository {
+	return &retryRepository{logger, repository, policy}
+}
+
+func (r *retryRepository) Migrate() error {
+	return r.repository.Migrate()
+}
+
+// Ping is not retried so that health checks see the database as it is right now.
+func (r *retryRepository) Ping(ctx context.Context) error {
+	return r.repository.Ping(ctx)
+}
+
+func (r *retryRepository) CreateSelection(ctx context.Context, selection Selection) error {
+	return r.retry(ctx, "CreateSelection", func() error {
+		return r.repository.CreateSelection(ctx, selection)
+	})
+}
+
+func (r *retryRepository) ReplaceSelection(ctx context.Context, selection Selection) (int64, error) {
+	deleted := int64(0)
+
+	err := r.retry(ctx, "ReplaceSelection", func() error {
+		var err error
+		deleted, err = r.repository.ReplaceSelection(ctx, selection)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (r *retryRepository) Selection(ctx context.Context, appId, instanceId, userId, serverId string) (Selection, error) {
+	selection := Selection{}
+
+	err := r.retry(ctx, "Selection", func() error {
+		var err error
+		selection, err = r.repository.Selection(ctx, appId, instanceId, userId, serverId)
+		return err
+	})
+
+	return selection, err
+}
+
+func (r *retryRepository) ListSelections(ctx context.Context, filter SelectionFilter) ([]SelectionSummary, error) {
+	var summaries []SelectionSummary
+
+	err := r.retry(ctx, "ListSelections", func() error {
+		var err error
+		summaries, err = r.repository.ListSelections(ctx, filter)
+		return err
+	})
+
+	return summaries, err
+}
+
+func (r *retryRepository) DeleteSelection(ctx context.Context, appId, instanceId, userId, serverId string) (int64, error) {
+	deleted := int64(0)
+
+	err := r.retry(ctx, "DeleteSelection", func() error {
+		var err error
+		deleted, err = r.repository.DeleteSelection(ctx, appId, instanceId, userId, serverId)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (r *retryRepository) DeleteInstance(ctx context.Context, appId, instanceId string) (int64, error) {
+	deleted := int64(0)
+
+	err := r.retry(ctx, "DeleteInstance", func() error {
+		var err error
+		deleted, err = r.repository.DeleteInstance(ctx, appId, instanceId)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (r *retryRepository) DeleteExpiredSelections(ctx context.Context) (int64, error) {
+	deleted := int64(0)
+
+	err := r.retry(ctx, "DeleteExpiredSelections", func() error {
+		var err error
+		deleted, err = r.repository.DeleteExpiredSelections(ctx)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (r *retryRepository) SaveBallot(ctx context.Context, ballot Ballot) error {
+	return r.retry(ctx, "SaveBallot", func() error {
+		return r.repository.SaveBallot(ctx, ballot)
+	})
+}
+
+func (r *retryRepository) Ballot(ctx context.Context, appId, instanceId, userId, serverId string) (Ballot, error) {
+	ballot := Ballot{}
+
+	err := r.retry(ctx, "Ballot", func() error {
+		var err error
+		ballot, err = r.repository.Ballot(ctx, appId, instanceId, userId, serverId)
+		return err
+	})
+
+	return ballot, err
+}
+
+func (r *retryRepository) Ballots(ctx context.Context, appId, instanceId string) ([]Ballot, error) {
+	var ballots []Ballot
+
+	err := r.retry(ctx, "Ballots", func() error {
+		var err error
+		ballots, err = r.repository.Ballots(ctx, appId, instanceId)
+		return err
+	})
+
+	return ballots, err
+}
+
+// retry calls f until it succeeds, fails with an error that is not retryable, runs out
+// of attempts or ctx is done. Retries are logged with the method and attempt number.
+func (r *retryRepository) retry(ctx context.Context, method string, f func() error) error {
+	attempts := r.policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	ceiling := r.policy.BaseDelay
+
+	logger := requestid.Logger(ctx, r.logger)
+
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			if attempt > 1 {
+				logger.Info().
+					Str("method", method).
+					Int("retries", attempt-1).
+					Msg("repository call succeeded after retrying")
+			}
+
+			return nil
+		}
+
+		if !isRetryableError(err) {
+			return err
+		}
+
+		if attempt >= attempts {
+			logger.Warn().Err(err).
+				Str("method", method).
+				Int("retries", attempt-1).
+				Msg("repository call failed after exhausting retries")
+
+			return err
+		}
+
+		delay := time.Duration(0)
+		if ceiling > 0 {
+			delay = time.Duration(rand.Int63n(int64(ceiling)))
+		}
+
+		repositoryRetries.WithLabelValues(method).Inc()
+
+		logger.Warn().Err(err).
+			Str("method", method).
+			Int("attempt", attempt).
+			Str("backoff", delay.String()).
+			Msg("retrying repository call")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		ceiling *= 2
+		if ceiling > r.policy.MaxDelay {
+			ceiling = r.policy.MaxDelay
+		}
+	}
+}
+
+// isRetryableError reports whether a failed repository call may succeed when repeated
+// unchanged: transaction conflicts, lost connections and a busy database.
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "40", "08":
+			return true
+		}
+
+		switch pqErr.Code {
+		case "57P01", "57P02", "57P03":
+			return true
+		}
+
+		return false
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+			return true
+		}
+	}
+
+	return false
+}
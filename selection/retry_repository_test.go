@@ -0,0 +1,187 @@
+package selection
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jukeizu/selection/internal/requestid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", &pq.Error{Code: "40001"}, true},
+		{"deadlock", &pq.Error{Code: "40P01"}, true},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"crash shutdown", &pq.Error{Code: "57P02"}, true},
+		{"cannot connect now", &pq.Error{Code: "57P03"}, true},
+		{"query canceled", &pq.Error{Code: "57014"}, false},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"syntax error", &pq.Error{Code: "42601"}, false},
+		{"wrapped serialization failure", fmt.Errorf("upsert: %w", &pq.Error{Code: "40001"}), true},
+		{"bad connection", driver.ErrBadConn, true},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"deadline exceeded", context.DeadlineExceeded, false},
+		{"canceled", context.Canceled, false},
+		{"no rows", sql.ErrNoRows, false},
+		{"other", errors.New("could not marshal options"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isRetryableError(test.err); got != test.want {
+				t.Errorf("isRetryableError(%v) = %t, want %t", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+// failingRepository fails Selection with the errors in errs, one per call, and then
+// succeeds.
+type failingRepository struct {
+	Repository
+	errs  []error
+	calls int
+}
+
+func (r *failingRepository) Selection(ctx context.Context, appId, instanceId, userId, serverId string) (Selection, error) {
+	r.calls++
+
+	if r.calls <= len(r.errs) {
+		return Selection{}, r.errs[r.calls-1]
+	}
+
+	return Selection{AppId: appId}, nil
+}
+
+func TestRetryRepository(t *testing.T) {
+	conflict := &pq.Error{Code: "40001"}
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	tests := []struct {
+		name      string
+		policy    RetryPolicy
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{
+		{"success", policy, nil, nil, 1},
+		{"success after retries", policy, []error{conflict, conflict}, nil, 3},
+		{"attempts exhausted", policy, []error{conflict, conflict, conflict}, conflict, 3},
+		{"not retryable", policy, []error{sql.ErrNoRows}, sql.ErrNoRows, 1},
+		{"retryable then not retryable", policy, []error{conflict, sql.ErrNoRows}, sql.ErrNoRows, 2},
+		{"no attempts means one", RetryPolicy{}, []error{conflict}, conflict, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failing := &failingRepository{errs: test.errs}
+			repository := NewRetryRepository(zerolog.Nop(), failing, test.policy)
+
+			selection, err := repository.Selection(context.Background(), "app", "instance", "user", "server")
+			if err != test.wantErr {
+				t.Errorf("error = %v, want %v", err, test.wantErr)
+			}
+
+			if err == nil && selection.AppId != "app" {
+				t.Errorf("selection = %+v, want the one returned by the last attempt", selection)
+			}
+
+			if failing.calls != test.wantCalls {
+				t.Errorf("made %d calls, want %d", failing.calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryRepositoryMaxDelay(t *testing.T) {
+	errs := make([]error, 19)
+	for i := range errs {
+		errs[i] = &pq.Error{Code: "40001"}
+	}
+
+	failing := &failingRepository{errs: errs}
+
+	// Without MaxDelay the doubling backoff would add up to minutes.
+	policy := RetryPolicy{MaxAttempts: 20, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	repository := NewRetryRepository(zerolog.Nop(), failing, policy)
+
+	start := time.Now()
+
+	_, err := repository.Selection(context.Background(), "app", "instance", "user", "server")
+	if err != nil {
+		t.Fatalf("error = %v, want success on the last attempt", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("retries took %s, want backoff capped at %s", elapsed, policy.MaxDelay)
+	}
+}
+
+func TestRetryRepositoryContextDone(t *testing.T) {
+	failing := &failingRepository{errs: []error{&pq.Error{Code: "40001"}}}
+
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	repository := NewRetryRepository(zerolog.Nop(), failing, policy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := repository.Selection(ctx, "app", "instance", "user", "server")
+	if err != context.DeadlineExceeded {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if failing.calls != 1 {
+		t.Errorf("made %d calls, want 1", failing.calls)
+	}
+}
+
+func TestRetryRepositoryLogsRequestId(t *testing.T) {
+	conflict := &pq.Error{Code: "40001"}
+	policy := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		numLines int
+	}{
+		{"success after retry", []error{conflict}, 2},
+		{"attempts exhausted", []error{conflict, conflict}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			repository := NewRetryRepository(zerolog.New(out), &failingRepository{errs: test.errs}, policy)
+
+			ctx := requestid.NewContext(context.Background(), "req-1")
+			repository.Selection(ctx, "app", "instance", "user", "server")
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != test.numLines {
+				t.Fatalf("logged %d lines, want %d:\n%s", len(lines), test.numLines, out)
+			}
+
+			for _, line := range lines {
+				if !strings.Contains(line, `"requestId":"req-1"`) {
+					t.Errorf("log line has no requestId: %s", line)
+				}
+			}
+		})
+	}
+}
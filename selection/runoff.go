@@ -0,0 +1,119 @@
+package selection
+
+import (
+	"sort"
+)
+
+// InstantRunoff tallies ballots using instant-runoff voting.
+//
+// Each round every ballot counts towards its highest ranked option that has not been
+// eliminated. An option holding a majority of the ballots that are still active wins.
+// Otherwise the option with the fewest votes is eliminated and the next round begins.
+// Ties for elimination are broken by the fewest votes in the earliest round that
+// differs, then by OptionId.
+type InstantRunoff struct{}
+
+// Tally implements TallyMethod. Scores holds the counts of the final round.
+func (t InstantRunoff) Tally(ballots []Ballot) TallyResult {
+	rankings := ballotRankings(ballots)
+	options := rankedOptionSet(rankings)
+
+	result := TallyResult{
+		Method:     Runoff,
+		NumBallots: len(ballots),
+		Rounds:     []TallyRound{},
+		Scores:     []OptionCount{},
+	}
+
+	if len(options) < 1 {
+		return result
+	}
+
+	active := map[string]bool{}
+	for optionId := range options {
+		active[optionId] = true
+	}
+
+	history := []map[string]int{}
+
+	for len(active) > 0 {
+		counts := map[string]int{}
+		for optionId := range active {
+			counts[optionId] = 0
+		}
+
+		exhausted := 0
+
+		for _, ranking := range rankings {
+			optionId, ok := firstActiveOption(ranking, active)
+			if !ok {
+				exhausted++
+				continue
+			}
+
+			counts[optionId]++
+		}
+
+		history = append(history, counts)
+
+		round := TallyRound{
+			Round:     len(history),
+			Counts:    optionCounts(counts, options),
+			Exhausted: exhausted,
+		}
+
+		continuing := len(rankings) - exhausted
+
+		leader := round.Counts[0]
+		if len(active) == 1 || leader.Count*2 > continuing {
+			result.Winner = &leader.Option
+			result.Scores = round.Counts
+			result.Rounds = append(result.Rounds, round)
+			break
+		}
+
+		eliminated := runoffLoser(active, history)
+		delete(active, eliminated)
+
+		eliminatedOption := options[eliminated]
+		round.Eliminated = &eliminatedOption
+
+		result.Rounds = append(result.Rounds, round)
+	}
+
+	return result
+}
+
+func runoffLoser(active map[string]bool, history []map[string]int) string {
+	candidates := []string{}
+	for optionId := range active {
+		candidates = append(candidates, optionId)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		current := history[len(history)-1]
+		if current[candidates[i]] != current[candidates[j]] {
+			return current[candidates[i]] < current[candidates[j]]
+		}
+
+		for _, counts := range history {
+			if counts[candidates[i]] != counts[candidates[j]] {
+				return counts[candidates[i]] < counts[candidates[j]]
+			}
+		}
+
+		return candidates[i] < candidates[j]
+	})
+
+	return candidates[0]
+}
+
+func firstActiveOption(ranking []RankedOption, active map[string]bool) (string, bool) {
+	for _, rankedOption := range ranking {
+		if active[rankedOption.Option.OptionId] {
+			return rankedOption.Option.OptionId, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,180 @@
+package selection
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// testBallots returns n ballots that each rank optionIds in order.
+func testBallots(n int, optionIds ...string) []Ballot {
+	ballots := []Ballot{}
+
+	for i := 0; i < n; i++ {
+		rankedOptions := []RankedOption{}
+		for rank, optionId := range optionIds {
+			rankedOptions = append(rankedOptions, RankedOption{
+				Rank:   rank,
+				Number: rank + 1,
+				Option: Option{OptionId: optionId, Content: optionId},
+			})
+		}
+
+		ballots = append(ballots, Ballot{Options: rankedOptions})
+	}
+
+	return ballots
+}
+
+// tennesseeBallots is the classic example of voters choosing a capital for Tennessee,
+// one ballot per percent of the vote.
+func tennesseeBallots() []Ballot {
+	ballots := []Ballot{}
+	ballots = append(ballots, testBallots(42, "memphis", "nashville", "chattanooga", "knoxville")...)
+	ballots = append(ballots, testBallots(26, "nashville", "chattanooga", "knoxville", "memphis")...)
+	ballots = append(ballots, testBallots(15, "chattanooga", "knoxville", "nashville", "memphis")...)
+	ballots = append(ballots, testBallots(17, "knoxville", "chattanooga", "nashville", "memphis")...)
+
+	return ballots
+}
+
+// testCounts flattens counts to OptionId and count pairs for comparison.
+func testCounts(counts []OptionCount) []string {
+	flattened := []string{}
+	for _, count := range counts {
+		flattened = append(flattened, count.Option.OptionId+"="+strconv.Itoa(count.Count))
+	}
+
+	return flattened
+}
+
+func TestInstantRunoff(t *testing.T) {
+	type round struct {
+		counts     []string
+		eliminated string
+		exhausted  int
+	}
+
+	tests := []struct {
+		name    string
+		ballots []Ballot
+		winner  string
+		rounds  []round
+	}{
+		{
+			name:    "tennessee",
+			ballots: tennesseeBallots(),
+			winner:  "knoxville",
+			rounds: []round{
+				{[]string{"memphis=42", "nashville=26", "knoxville=17", "chattanooga=15"}, "chattanooga", 0},
+				{[]string{"memphis=42", "knoxville=32", "nashville=26"}, "nashville", 0},
+				{[]string{"knoxville=58", "memphis=42"}, "", 0},
+			},
+		},
+		{
+			name: "first round majority",
+			ballots: append(
+				testBallots(3, "a", "b"),
+				testBallots(2, "b", "a")...),
+			winner: "a",
+			rounds: []round{
+				{[]string{"a=3", "b=2"}, "", 0},
+			},
+		},
+		{
+			name: "exhausted ballots and tie broken by option id",
+			ballots: append(append(
+				testBallots(2, "a"),
+				testBallots(2, "b")...),
+				testBallots(1, "c")...),
+			winner: "b",
+			rounds: []round{
+				{[]string{"a=2", "b=2", "c=1"}, "c", 0},
+				{[]string{"a=2", "b=2"}, "a", 1},
+				{[]string{"b=2"}, "", 3},
+			},
+		},
+		{
+			name: "tie broken by earlier round",
+			ballots: append(append(append(
+				testBallots(5, "a"),
+				testBallots(4, "b")...),
+				testBallots(3, "c", "a")...),
+				testBallots(1, "d", "c", "b")...),
+			winner: "a",
+			rounds: []round{
+				{[]string{"a=5", "b=4", "c=3", "d=1"}, "d", 0},
+				{[]string{"a=5", "b=4", "c=4"}, "c", 0},
+				{[]string{"a=8", "b=5"}, "", 0},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := InstantRunoff{}.Tally(test.ballots)
+
+			if result.Method != Runoff || result.NumBallots != len(test.ballots) {
+				t.Errorf("method, ballots = %s, %d, want %s, %d", result.Method, result.NumBallots, Runoff, len(test.ballots))
+			}
+
+			if result.Winner == nil || result.Winner.OptionId != test.winner {
+				t.Fatalf("winner = %v, want %s", result.Winner, test.winner)
+			}
+
+			if len(result.Rounds) != len(test.rounds) {
+				t.Fatalf("got %d rounds, want %d", len(result.Rounds), len(test.rounds))
+			}
+
+			for i, want := range test.rounds {
+				got := result.Rounds[i]
+
+				if got.Round != i+1 {
+					t.Errorf("round %d numbered %d", i+1, got.Round)
+				}
+
+				if counts := testCounts(got.Counts); !reflect.DeepEqual(counts, want.counts) {
+					t.Errorf("round %d counts = %v, want %v", i+1, counts, want.counts)
+				}
+
+				eliminated := ""
+				if got.Eliminated != nil {
+					eliminated = got.Eliminated.OptionId
+				}
+				if eliminated != want.eliminated {
+					t.Errorf("round %d eliminated %q, want %q", i+1, eliminated, want.eliminated)
+				}
+
+				if got.Exhausted != want.exhausted {
+					t.Errorf("round %d exhausted = %d, want %d", i+1, got.Exhausted, want.exhausted)
+				}
+			}
+
+			last := test.rounds[len(test.rounds)-1]
+			if scores := testCounts(result.Scores); !reflect.DeepEqual(scores, last.counts) {
+				t.Errorf("scores = %v, want the final round %v", scores, last.counts)
+			}
+		})
+	}
+}
+
+func TestInstantRunoffNoBallots(t *testing.T) {
+	result := InstantRunoff{}.Tally(nil)
+
+	if result.Winner != nil || len(result.Rounds) != 0 || len(result.Scores) != 0 {
+		t.Errorf("Tally(nil) = %+v, want no winner, rounds or scores", result)
+	}
+}
+
+func TestInstantRunoffRanksByRank(t *testing.T) {
+	ballot := Ballot{Options: []RankedOption{
+		{Rank: 1, Number: 1, Option: Option{OptionId: "a"}},
+		{Rank: 0, Number: 2, Option: Option{OptionId: "b"}},
+	}}
+
+	result := InstantRunoff{}.Tally([]Ballot{ballot})
+
+	if result.Winner == nil || result.Winner.OptionId != "b" {
+		t.Errorf("winner = %v, want the option ranked first", result.Winner)
+	}
+}
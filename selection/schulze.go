@@ -0,0 +1,125 @@
+package selection
+
+import (
+	"sort"
+)
+
+// SchulzeMethod tallies ballots using the Schulze Condorcet method.
+//
+// Options missing from a ballot are treated as ranked below every option on it.
+// An option's score is the number of other options it beats by strongest path,
+// so a Condorcet winner scores one less than the number of options.
+type SchulzeMethod struct{}
+
+// Tally implements TallyMethod.
+func (t SchulzeMethod) Tally(ballots []Ballot) TallyResult {
+	rankings := ballotRankings(ballots)
+	options := rankedOptionSet(rankings)
+
+	optionIds := []string{}
+	for optionId := range options {
+		optionIds = append(optionIds, optionId)
+	}
+	sort.Strings(optionIds)
+
+	n := len(optionIds)
+
+	index := map[string]int{}
+	for i, optionId := range optionIds {
+		index[optionId] = i
+	}
+
+	preferences := make([][]int, n)
+	for i := range preferences {
+		preferences[i] = make([]int, n)
+	}
+
+	for _, ranking := range rankings {
+		ranked := map[int]bool{}
+
+		for _, rankedOption := range uniqueRanking(ranking) {
+			i := index[rankedOption.Option.OptionId]
+
+			for j := 0; j < n; j++ {
+				if i != j && !ranked[j] {
+					preferences[i][j]++
+				}
+			}
+
+			ranked[i] = true
+		}
+	}
+
+	strengths := schulzeStrengths(preferences)
+
+	scores := zeroCounts(options)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if i != j && strengths[i][j] > strengths[j][i] {
+				scores[optionIds[i]]++
+			}
+		}
+	}
+
+	pairwise := []PairwiseCount{}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if i == j {
+				continue
+			}
+
+			pairwise = append(pairwise, PairwiseCount{
+				Option:  options[optionIds[i]],
+				Against: options[optionIds[j]],
+				Count:   preferences[i][j],
+			})
+		}
+	}
+
+	result := scoredTallyResult(Schulze, len(ballots), optionCounts(scores, options))
+	result.Pairwise = pairwise
+
+	return result
+}
+
+// schulzeStrengths computes the strongest path strengths between every pair of options
+// from the pairwise preference matrix.
+func schulzeStrengths(preferences [][]int) [][]int {
+	n := len(preferences)
+
+	strengths := make([][]int, n)
+	for i := range strengths {
+		strengths[i] = make([]int, n)
+
+		for j := 0; j < n; j++ {
+			if i != j && preferences[i][j] > preferences[j][i] {
+				strengths[i][j] = preferences[i][j]
+			}
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if i == j {
+				continue
+			}
+
+			for k := 0; k < n; k++ {
+				if i == k || j == k {
+					continue
+				}
+
+				strength := strengths[j][i]
+				if strengths[i][k] < strength {
+					strength = strengths[i][k]
+				}
+
+				if strength > strengths[j][k] {
+					strengths[j][k] = strength
+				}
+			}
+		}
+	}
+
+	return strengths
+}
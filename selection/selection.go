@@ -1,6 +1,9 @@
 package selection
 
 import (
+	"context"
+	"time"
+
 	"github.com/rs/zerolog"
 )
 
@@ -14,6 +17,9 @@ type CreateSelectionRequest struct {
 	SortMethod SortMethod
 	SortKey    string
 	Options    []Option
+	Regenerate bool
+	ExpiresAt  time.Time
+	Ttl        time.Duration
 }
 
 type Option struct {
@@ -22,12 +28,15 @@ type Option struct {
 	Metadata map[string]string
 }
 
+// ParseSelectionRequest ranks Content against a user's selection. The result is saved
+// as the user's ballot unless DryRun is set.
 type ParseSelectionRequest struct {
 	AppId      string
 	InstanceId string
 	UserId     string
 	ServerId   string
 	Content    string
+	DryRun     bool
 }
 
 type Selection struct {
@@ -37,11 +46,99 @@ type Selection struct {
 	UserId     string
 	ServerId   string
 	Options    map[int]Option
+	Retired    map[int]Option
+	ExpiresAt  time.Time
+	Created    time.Time
+	Updated    time.Time
+}
+
+type GetSelectionRequest struct {
+	AppId      string
+	InstanceId string
+	UserId     string
+	ServerId   string
+}
+
+type ListSelectionsRequest struct {
+	AppId         string
+	InstanceId    string
+	UserId        string
+	ServerId      string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	PageSize      int
+	PageToken     string
+}
+
+type ListSelectionsReply struct {
+	Selections    []SelectionSummary
+	NextPageToken string
+}
+
+// SelectionFilter narrows the selections returned by Repository.ListSelections.
+// Empty strings and zero times match everything.
+type SelectionFilter struct {
+	AppId         string
+	InstanceId    string
+	UserId        string
+	ServerId      string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	AfterCreated  time.Time
+	AfterId       string
+	Limit         int
+}
+
+type SelectionSummary struct {
+	Id         string
+	AppId      string
+	InstanceId string
+	UserId     string
+	ServerId   string
+	NumOptions int
+	Created    time.Time
+	Updated    time.Time
+	ExpiresAt  time.Time
+}
+
+type DeleteSelectionRequest struct {
+	AppId      string
+	InstanceId string
+	UserId     string
+	ServerId   string
+	Instance   bool
+}
+
+type DeleteSelectionReply struct {
+	Deleted int64
+}
+
+type UpdateSelectionRequest struct {
+	AppId      string
+	InstanceId string
+	UserId     string
+	ServerId   string
+	BatchSize  int
+	SortMethod SortMethod
+	SortKey    string
+	Options    []Option
+}
+
+type UpdateSelectionReply struct {
+	Selection Selection
+	Batches   []Batch
+	Added     []BatchOption
+	Retired   []BatchOption
 }
 
 type SelectionReply struct {
 	Selection Selection
 	Batches   []Batch
+	Status    SelectionStatus
 }
 
 type QuerySelectionRequest struct {
@@ -66,6 +163,25 @@ const (
 	Metadata     = SortMethod("metadata")
 )
 
+// SelectionStatus describes what Create did to produce a selection.
+type SelectionStatus string
+
+const (
+	SelectionCreated  = SelectionStatus("created")
+	SelectionReused   = SelectionStatus("reused")
+	SelectionReplaced = SelectionStatus("replaced")
+)
+
+type VotingMethod string
+
+const (
+	Runoff    = VotingMethod("runoff")
+	Borda     = VotingMethod("borda")
+	Schulze   = VotingMethod("schulze")
+	Approval  = VotingMethod("approval")
+	Plurality = VotingMethod("plurality")
+)
+
 type Batch struct {
 	Options []BatchOption
 }
@@ -83,10 +199,68 @@ type RankedOption struct {
 	Option Option
 }
 
+type BallotRequest struct {
+	AppId      string
+	InstanceId string
+	UserId     string
+	ServerId   string
+}
+
+type Ballot struct {
+	Id         string
+	AppId      string
+	InstanceId string
+	UserId     string
+	ServerId   string
+	Options    []RankedOption
+	Created    time.Time
+	Updated    time.Time
+}
+
+type TallyRequest struct {
+	AppId      string
+	InstanceId string
+	Method     VotingMethod
+}
+
+type TallyResult struct {
+	Method     VotingMethod
+	Winner     *Option
+	Rounds     []TallyRound
+	Scores     []OptionCount
+	Pairwise   []PairwiseCount
+	NumBallots int
+}
+
+type TallyRound struct {
+	Round      int
+	Counts     []OptionCount
+	Eliminated *Option
+	Exhausted  int
+}
+
+type OptionCount struct {
+	Option Option
+	Count  int
+}
+
+// PairwiseCount is the number of ballots that rank Option above Against.
+type PairwiseCount struct {
+	Option  Option
+	Against Option
+	Count   int
+}
+
 type Service interface {
-	Create(CreateSelectionRequest) (SelectionReply, error)
-	Parse(ParseSelectionRequest) ([]RankedOption, error)
-	Query(QuerySelectionRequest) (QuerySelectionReply, error)
+	Create(context.Context, CreateSelectionRequest) (SelectionReply, error)
+	Get(context.Context, GetSelectionRequest) (Selection, error)
+	Update(context.Context, UpdateSelectionRequest) (UpdateSelectionReply, error)
+	Delete(context.Context, DeleteSelectionRequest) (DeleteSelectionReply, error)
+	List(context.Context, ListSelectionsRequest) (ListSelectionsReply, error)
+	Parse(context.Context, ParseSelectionRequest) ([]RankedOption, error)
+	Query(context.Context, QuerySelectionRequest) (QuerySelectionReply, error)
+	Ballot(context.Context, BallotRequest) (Ballot, error)
+	Tally(context.Context, TallyRequest) (TallyResult, error)
 }
 
 func (selection Selection) MarshalZerologObject(e *zerolog.Event) {
@@ -96,3 +270,12 @@ func (selection Selection) MarshalZerologObject(e *zerolog.Event) {
 		Str("selection.UserId", selection.UserId).
 		Str("selection.ServerId", selection.ServerId)
 }
+
+func (ballot Ballot) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("ballot.Id", ballot.Id).
+		Str("ballot.AppId", ballot.AppId).
+		Str("ballot.InstanceId", ballot.InstanceId).
+		Str("ballot.UserId", ballot.UserId).
+		Str("ballot.ServerId", ballot.ServerId).
+		Int("ballot.NumOptions", len(ballot.Options))
+}
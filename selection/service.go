@@ -1,51 +1,84 @@
 package selection
 
 import (
+	"context"
 	"database/sql"
 	"math/rand"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jukeizu/selection/internal/requestid"
 	"github.com/rs/zerolog"
 )
 
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+	MaxChoices      = 1000
+)
+
 type DefaultService struct {
-	logger          zerolog.Logger
-	repository      Repository
-	sorter          Sorter
-	batcher         Batcher
-	parseRegex      *regexp.Regexp
-	validationRegex *regexp.Regexp
+	logger     zerolog.Logger
+	repository Repository
+	sorter     Sorter
+	batcher    Batcher
+	tallier    Tallier
+	parser     choiceParser
 }
 
-func NewDefaultService(logger zerolog.Logger, repository Repository, sorter Sorter, batcher Batcher) Service {
-	parseRegex := regexp.MustCompile(`\b\d+\b`)
-	validationRegex := regexp.MustCompile(`^[\d\s]+$`)
-	return &DefaultService{logger, repository, sorter, batcher, parseRegex, validationRegex}
+func NewDefaultService(logger zerolog.Logger, repository Repository, sorter Sorter, batcher Batcher, tallier Tallier) Service {
+	return &DefaultService{logger, repository, sorter, batcher, tallier, newChoiceParser()}
 }
 
-func (s DefaultService) Create(req CreateSelectionRequest) (SelectionReply, error) {
-	selection, err := s.repository.Selection(req.AppId, req.InstanceId, req.UserId, req.ServerId)
-	if err == nil {
+func (s DefaultService) Create(ctx context.Context, req CreateSelectionRequest) (SelectionReply, error) {
+	s.logger = requestid.Logger(ctx, s.logger)
+
+	if !req.ExpiresAt.IsZero() && !req.ExpiresAt.After(time.Now()) {
+		expiresAt := req.ExpiresAt.UTC().Format(time.RFC3339)
+		return SelectionReply{}, NewValidationError("Expiry `%s` is not in the future.", expiresAt).WithField("expires_at", expiresAt)
+	}
+	if req.Ttl < 0 {
+		ttl := strconv.FormatInt(int64(req.Ttl/time.Second), 10)
+		return SelectionReply{}, NewValidationError("TTL of `%s` seconds must not be negative.", ttl).WithField("ttl_seconds", ttl)
+	}
+
+	// Create numbers options by position, so options may go without an id. Ids that are
+	// set must be unique, since Update, Query and tallies tell options apart by id.
+	if optionId, ok := duplicateOptionId(req.Options); ok {
+		return SelectionReply{}, NewValidationError("Option id `%s` is listed more than once.", optionId).WithField("options", optionId)
+	}
+
+	selection, err := s.repository.Selection(ctx, req.AppId, req.InstanceId, req.UserId, req.ServerId)
+	if err == nil && !req.Regenerate {
 		s.logger.Info().
 			EmbedObject(selection).
 			Msg("found existing selection")
 
-		return s.createSelectionReply(req, selection), nil
+		return s.createSelectionReply(ctx, req, selection, SelectionReused), nil
 	}
 	if err != nil && err != sql.ErrNoRows {
 		return SelectionReply{}, err
 	}
 
+	status := SelectionCreated
+	if err == nil {
+		status = SelectionReplaced
+	}
+
 	selection = Selection{
 		AppId:      req.AppId,
 		InstanceId: req.InstanceId,
 		UserId:     req.UserId,
 		ServerId:   req.ServerId,
 		Options:    map[int]Option{},
+		Retired:    map[int]Option{},
+		ExpiresAt:  req.ExpiresAt,
+	}
+
+	if selection.ExpiresAt.IsZero() && req.Ttl > 0 {
+		selection.ExpiresAt = time.Now().Add(req.Ttl)
 	}
 
 	if req.Randomize {
@@ -56,61 +89,310 @@ func (s DefaultService) Create(req CreateSelectionRequest) (SelectionReply, erro
 		selection.Options[i+1] = option
 	}
 
-	err = s.repository.CreateSelection(selection)
+	// A ballot left from a replaced or expired selection ranks the old numbering, so it
+	// is discarded rather than counted against the new options.
+	deletedBallots, err := s.repository.ReplaceSelection(ctx, selection)
 	if err != nil {
 		return SelectionReply{}, err
 	}
 
 	s.logger.Info().
 		EmbedObject(selection).
+		Str("status", string(status)).
+		Int64("deletedBallots", deletedBallots).
 		Msg("created selection")
 
-	return s.createSelectionReply(req, selection), nil
+	return s.createSelectionReply(ctx, req, selection, status), nil
+}
+
+func (s DefaultService) Get(ctx context.Context, req GetSelectionRequest) (Selection, error) {
+	selection, err := s.repository.Selection(ctx, req.AppId, req.InstanceId, req.UserId, req.ServerId)
+	if err == sql.ErrNoRows {
+		return Selection{}, NewNotFoundError("No selection exists for this user in instance `%s`.", req.InstanceId)
+	}
+	if err != nil {
+		return Selection{}, err
+	}
+
+	return selection, nil
 }
 
-func (s DefaultService) Parse(req ParseSelectionRequest) ([]RankedOption, error) {
-	if !s.validationRegex.MatchString(req.Content) {
-		return nil, NewValidationError("Input may only contain numeric values.")
+func (s DefaultService) Update(ctx context.Context, req UpdateSelectionRequest) (UpdateSelectionReply, error) {
+	s.logger = requestid.Logger(ctx, s.logger)
+
+	// Options are matched to their numbers by id, so every option needs a unique id.
+	for i, option := range req.Options {
+		if option.OptionId == "" {
+			return UpdateSelectionReply{}, NewValidationError("Option %d has no option id. Updating a selection matches options by id, so every option needs one.", i+1).WithField("options", "")
+		}
+	}
+	if optionId, ok := duplicateOptionId(req.Options); ok {
+		return UpdateSelectionReply{}, NewValidationError("Option id `%s` is listed more than once.", optionId).WithField("options", optionId)
 	}
 
-	selection, err := s.repository.Selection(req.AppId, req.InstanceId, req.UserId, req.ServerId)
+	selection, err := s.repository.Selection(ctx, req.AppId, req.InstanceId, req.UserId, req.ServerId)
+	if err == sql.ErrNoRows {
+		return UpdateSelectionReply{}, NewNotFoundError("No selection exists for this user in instance `%s`.", req.InstanceId)
+	}
 	if err != nil {
-		return nil, err
+		return UpdateSelectionReply{}, err
 	}
 
-	choices := s.parseRegex.FindAllString(req.Content, -1)
+	// A selection created with an id under several numbers keeps the lowest one. The
+	// others are retired below.
+	numbers := lowestNumbers(selection.Options)
+	retiredNumbers := lowestNumbers(selection.Retired)
 
-	rankedOptions := []RankedOption{}
+	nextNumber := 1
+	for number := range selection.Options {
+		if number >= nextNumber {
+			nextNumber = number + 1
+		}
+	}
+	for number := range selection.Retired {
+		if number >= nextNumber {
+			nextNumber = number + 1
+		}
+	}
+
+	options := map[int]Option{}
+	retired := map[int]Option{}
+	for number, option := range selection.Retired {
+		retired[number] = option
+	}
+
+	added := BatchOptions{}
+
+	for _, option := range req.Options {
+		if number, ok := numbers[option.OptionId]; ok {
+			options[number] = option
+			continue
+		}
+
+		number, ok := retiredNumbers[option.OptionId]
+		if ok {
+			delete(retired, number)
+		} else {
+			number = nextNumber
+			nextNumber++
+		}
+
+		options[number] = option
+		added = append(added, BatchOption{Number: number, Option: option})
+	}
+
+	removed := BatchOptions{}
+
+	for number, option := range selection.Options {
+		if _, ok := options[number]; ok {
+			continue
+		}
+
+		retired[number] = option
+		removed = append(removed, BatchOption{Number: number, Option: option})
+	}
+
+	selection.Options = options
+	selection.Retired = retired
+
+	err = s.repository.CreateSelection(ctx, selection)
+	if err != nil {
+		return UpdateSelectionReply{}, err
+	}
+
+	s.logger.Info().
+		EmbedObject(selection).
+		Int("numAdded", len(added)).
+		Int("numRetired", len(removed)).
+		Msg("updated selection")
+
+	return UpdateSelectionReply{
+		Selection: selection,
+		Batches:   s.createBatches(ctx, selection, req.SortMethod, req.SortKey, req.BatchSize),
+		Added:     SortByNumber{}.Sort(added),
+		Retired:   SortByNumber{}.Sort(removed),
+	}, nil
+}
+
+func (s DefaultService) List(ctx context.Context, req ListSelectionsRequest) (ListSelectionsReply, error) {
+	pageSize := req.PageSize
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	filter := SelectionFilter{
+		AppId:         req.AppId,
+		InstanceId:    req.InstanceId,
+		UserId:        req.UserId,
+		ServerId:      req.ServerId,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		UpdatedAfter:  req.UpdatedAfter,
+		UpdatedBefore: req.UpdatedBefore,
+		Limit:         pageSize + 1,
+	}
 
-	for i, choice := range choices {
-		c, err := strconv.Atoi(choice)
+	if req.PageToken != "" {
+		cursor, err := decodeSelectionCursor(req.PageToken)
 		if err != nil {
-			return nil, NewValidationError("Input `%s` is not a valid selection.", choice)
+			return ListSelectionsReply{}, err
 		}
 
-		option, ok := selection.Options[c]
-		if !ok {
-			return nil, NewValidationError("Input `%d` is not a valid selection.", c)
+		filter.AfterCreated = cursor.Created
+		filter.AfterId = cursor.Id
+	}
+
+	summaries, err := s.repository.ListSelections(ctx, filter)
+	if err != nil {
+		return ListSelectionsReply{}, err
+	}
+
+	reply := ListSelectionsReply{
+		Selections: summaries,
+	}
+
+	if len(summaries) > pageSize {
+		reply.Selections = summaries[:pageSize]
+
+		last := reply.Selections[pageSize-1]
+		reply.NextPageToken = selectionCursor{Created: last.Created, Id: last.Id}.Encode()
+	}
+
+	return reply, nil
+}
+
+func (s DefaultService) Delete(ctx context.Context, req DeleteSelectionRequest) (DeleteSelectionReply, error) {
+	s.logger = requestid.Logger(ctx, s.logger)
+
+	if req.Instance {
+		deleted, err := s.repository.DeleteInstance(ctx, req.AppId, req.InstanceId)
+		if err != nil {
+			return DeleteSelectionReply{}, err
 		}
 
-		rankedOption := RankedOption{
-			Rank:   i,
-			Number: c,
-			Option: option,
+		s.logger.Info().
+			Str("appId", req.AppId).
+			Str("instanceId", req.InstanceId).
+			Int64("deleted", deleted).
+			Msg("deleted instance selections")
+
+		return DeleteSelectionReply{Deleted: deleted}, nil
+	}
+
+	deleted, err := s.repository.DeleteSelection(ctx, req.AppId, req.InstanceId, req.UserId, req.ServerId)
+	if err != nil {
+		return DeleteSelectionReply{}, err
+	}
+
+	s.logger.Info().
+		Str("appId", req.AppId).
+		Str("instanceId", req.InstanceId).
+		Str("userId", req.UserId).
+		Str("serverId", req.ServerId).
+		Int64("deleted", deleted).
+		Msg("deleted selection")
+
+	return DeleteSelectionReply{Deleted: deleted}, nil
+}
+
+func (s DefaultService) Parse(ctx context.Context, req ParseSelectionRequest) ([]RankedOption, error) {
+	rankedOptions, err := s.parse(ctx, req)
+
+	switch e := err.(type) {
+	case ValidationError:
+		parseFailures.WithLabelValues(e.Reason).Inc()
+	case ResourceExhaustedError:
+		parseFailures.WithLabelValues(ReasonTooManyChoices).Inc()
+	case FailedPreconditionError:
+		parseFailures.WithLabelValues(ReasonNoSelection).Inc()
+	}
+
+	return rankedOptions, err
+}
+
+func (s DefaultService) parse(ctx context.Context, req ParseSelectionRequest) ([]RankedOption, error) {
+	s.logger = requestid.Logger(ctx, s.logger)
+
+	_, span := tracer.Start(ctx, "choiceParser.Parse")
+	choiceRanges, err := s.parser.Parse(req.Content)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	selection, err := s.repository.Selection(ctx, req.AppId, req.InstanceId, req.UserId, req.ServerId)
+	if err == sql.ErrNoRows {
+		return nil, NewFailedPreconditionError("No selection exists for this user in instance `%s`. Create one before parsing input.", req.InstanceId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rankedOptions := []RankedOption{}
+
+	for _, choiceRange := range choiceRanges {
+		for c := choiceRange.Start; c <= choiceRange.End; c++ {
+			option, ok := selection.Options[c]
+			if retired, isRetired := selection.Retired[c]; !ok && isRetired {
+				return nil, NewValidationError("Input `%d` (%s) is no longer available.", c, retired.Content).WithField("content", choiceRange.Token).WithReason(ReasonRetiredOption)
+			}
+			if !ok && choiceRange.Start == choiceRange.End {
+				return nil, NewValidationError("Input `%d` is not a valid selection.", c).WithField("content", choiceRange.Token).WithReason(ReasonUnknownOption)
+			}
+			if !ok {
+				return nil, NewValidationError("Input `%d` in range `%s` is not a valid selection.", c, choiceRange.Token).WithField("content", choiceRange.Token).WithReason(ReasonUnknownOption)
+			}
+
+			if len(rankedOptions) >= MaxChoices {
+				return nil, NewResourceExhaustedError("Input may contain at most %d choices.", MaxChoices)
+			}
+
+			rankedOption := RankedOption{
+				Rank:   len(rankedOptions),
+				Number: c,
+				Option: option,
+			}
+
+			rankedOptions = append(rankedOptions, rankedOption)
 		}
+	}
+
+	ballot := Ballot{
+		AppId:      req.AppId,
+		InstanceId: req.InstanceId,
+		UserId:     req.UserId,
+		ServerId:   req.ServerId,
+		Options:    rankedOptions,
+	}
 
-		rankedOptions = append(rankedOptions, rankedOption)
+	if req.DryRun {
+		return rankedOptions, nil
 	}
 
+	err = s.repository.SaveBallot(ctx, ballot)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		EmbedObject(ballot).
+		Msg("saved ballot")
+
 	return rankedOptions, nil
 }
 
-func (s DefaultService) Query(req QuerySelectionRequest) (QuerySelectionReply, error) {
+func (s DefaultService) Query(ctx context.Context, req QuerySelectionRequest) (QuerySelectionReply, error) {
 	if req.Options == nil || len(req.Options) < 1 {
 		return QuerySelectionReply{}, nil
 	}
 
-	selection, err := s.repository.Selection(req.AppId, req.InstanceId, req.UserId, req.ServerId)
+	selection, err := s.repository.Selection(ctx, req.AppId, req.InstanceId, req.UserId, req.ServerId)
+	if err == sql.ErrNoRows {
+		return QuerySelectionReply{}, NewFailedPreconditionError("No selection exists for this user in instance `%s`. Create one before querying it.", req.InstanceId)
+	}
 	if err != nil {
 		return QuerySelectionReply{}, err
 	}
@@ -147,20 +429,58 @@ func (s DefaultService) Query(req QuerySelectionRequest) (QuerySelectionReply, e
 	}, nil
 }
 
-func (s DefaultService) createSelectionReply(req CreateSelectionRequest, selection Selection) SelectionReply {
-	batchOptions := s.createBatchOptions(req, selection)
+func (s DefaultService) Ballot(ctx context.Context, req BallotRequest) (Ballot, error) {
+	ballot, err := s.repository.Ballot(ctx, req.AppId, req.InstanceId, req.UserId, req.ServerId)
+	if err == sql.ErrNoRows {
+		return Ballot{}, NewNotFoundError("No ballot exists for this user in instance `%s`.", req.InstanceId)
+	}
+	if err != nil {
+		return Ballot{}, err
+	}
 
-	sortedBatchOptions := s.sorter.Sort(batchOptions, req.SortMethod, req.SortKey)
+	return ballot, nil
+}
+
+func (s DefaultService) Tally(ctx context.Context, req TallyRequest) (TallyResult, error) {
+	s.logger = requestid.Logger(ctx, s.logger)
+
+	ballots, err := s.repository.Ballots(ctx, req.AppId, req.InstanceId)
+	if err != nil {
+		return TallyResult{}, err
+	}
+
+	result := s.tallier.Tally(ctx, ballots, req.Method)
+
+	s.logger.Info().
+		Str("appId", req.AppId).
+		Str("instanceId", req.InstanceId).
+		Str("votingMethod", string(result.Method)).
+		Int("numBallots", result.NumBallots).
+		Int("numRounds", len(result.Rounds)).
+		Msg("tallied selection")
+
+	return result, nil
+}
 
+func (s DefaultService) createSelectionReply(ctx context.Context, req CreateSelectionRequest, selection Selection, status SelectionStatus) SelectionReply {
 	selectionReply := SelectionReply{
 		Selection: selection,
-		Batches:   s.batcher.CreateBatches(sortedBatchOptions, req.BatchSize),
+		Batches:   s.createBatches(ctx, selection, req.SortMethod, req.SortKey, req.BatchSize),
+		Status:    status,
 	}
 
 	return selectionReply
 }
 
-func (s DefaultService) createBatchOptions(req CreateSelectionRequest, selection Selection) []BatchOption {
+func (s DefaultService) createBatches(ctx context.Context, selection Selection, sortMethod SortMethod, sortKey string, batchSize int) []Batch {
+	batchOptions := s.createBatchOptions(selection)
+
+	sortedBatchOptions := s.sorter.Sort(ctx, batchOptions, sortMethod, sortKey)
+
+	return s.batcher.CreateBatches(ctx, sortedBatchOptions, batchSize)
+}
+
+func (s DefaultService) createBatchOptions(selection Selection) []BatchOption {
 	batchOptions := BatchOptions{}
 
 	for k, option := range selection.Options {
@@ -186,3 +506,35 @@ func (s DefaultService) shuffleOptions(options []Option) []Option {
 
 	return options
 }
+
+// duplicateOptionId returns the first OptionId listed more than once in options,
+// ignoring options without an id.
+func duplicateOptionId(options []Option) (string, bool) {
+	seen := map[string]bool{}
+
+	for _, option := range options {
+		if option.OptionId == "" {
+			continue
+		}
+
+		if seen[option.OptionId] {
+			return option.OptionId, true
+		}
+		seen[option.OptionId] = true
+	}
+
+	return "", false
+}
+
+// lowestNumbers maps the OptionId of every option in options to its lowest number.
+func lowestNumbers(options map[int]Option) map[string]int {
+	numbers := map[string]int{}
+
+	for number, option := range options {
+		if lowest, ok := numbers[option.OptionId]; !ok || number < lowest {
+			numbers[option.OptionId] = number
+		}
+	}
+
+	return numbers
+}
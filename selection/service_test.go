@@ -0,0 +1,342 @@
+package selection
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCreateRegenerateDiscardsBallot(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(NewMemoryRepository())
+
+	create := CreateSelectionRequest{
+		AppId:      "app",
+		InstanceId: "instance",
+		UserId:     "user",
+		Options:    []Option{{OptionId: "a", Content: "A"}, {OptionId: "b", Content: "B"}},
+	}
+
+	_, err := service.Create(ctx, create)
+	if err != nil {
+		t.Fatalf("Create returned error: %s", err)
+	}
+
+	_, err = service.Parse(ctx, ParseSelectionRequest{AppId: "app", InstanceId: "instance", UserId: "user", Content: "2"})
+	if err != nil {
+		t.Fatalf("Parse returned error: %s", err)
+	}
+
+	reused, err := service.Create(ctx, create)
+	if err != nil {
+		t.Fatalf("Create returned error: %s", err)
+	}
+
+	_, err = service.Ballot(ctx, BallotRequest{AppId: "app", InstanceId: "instance", UserId: "user"})
+	if reused.Status != SelectionReused || err != nil {
+		t.Fatalf("reusing the selection: status %s, Ballot error %v, want the ballot kept", reused.Status, err)
+	}
+
+	create.Regenerate = true
+	create.Options = []Option{{OptionId: "c", Content: "C"}, {OptionId: "a", Content: "A"}}
+
+	replaced, err := service.Create(ctx, create)
+	if err != nil {
+		t.Fatalf("Create returned error: %s", err)
+	}
+	if replaced.Status != SelectionReplaced {
+		t.Errorf("status = %s, want %s", replaced.Status, SelectionReplaced)
+	}
+
+	_, err = service.Ballot(ctx, BallotRequest{AppId: "app", InstanceId: "instance", UserId: "user"})
+	if _, ok := err.(NotFoundError); !ok {
+		t.Errorf("Ballot error = %#v, want a NotFoundError", err)
+	}
+
+	result, err := service.Tally(ctx, TallyRequest{AppId: "app", InstanceId: "instance", Method: Plurality})
+	if err != nil {
+		t.Fatalf("Tally returned error: %s", err)
+	}
+	if result.NumBallots != 0 {
+		t.Errorf("tallied %d ballots, want 0", result.NumBallots)
+	}
+}
+
+func TestCreateRejectsDuplicateOptionIds(t *testing.T) {
+	service := newTestService(NewMemoryRepository())
+
+	_, err := service.Create(context.Background(), CreateSelectionRequest{
+		AppId:      "app",
+		InstanceId: "instance",
+		UserId:     "user",
+		Options:    []Option{{OptionId: "a"}, {OptionId: "b"}, {OptionId: "a"}},
+	})
+
+	validationErr, ok := err.(ValidationError)
+	if !ok || validationErr.Field != "options" || validationErr.Token != "a" {
+		t.Errorf("error = %#v, want a ValidationError for option id a", err)
+	}
+
+	_, err = service.Create(context.Background(), CreateSelectionRequest{
+		AppId:      "app",
+		InstanceId: "instance",
+		UserId:     "user",
+		Options:    []Option{{Content: "A"}, {Content: "B"}},
+	})
+	if err != nil {
+		t.Errorf("Create with options without ids returned error: %s", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(NewMemoryRepository())
+
+	_, err := service.Create(ctx, CreateSelectionRequest{
+		AppId:      "app",
+		InstanceId: "instance",
+		UserId:     "user",
+		Options:    []Option{{OptionId: "a"}, {OptionId: "b"}, {OptionId: "c"}},
+	})
+	if err != nil {
+		t.Fatalf("Create returned error: %s", err)
+	}
+
+	reply, err := service.Update(ctx, UpdateSelectionRequest{
+		AppId:      "app",
+		InstanceId: "instance",
+		UserId:     "user",
+		Options:    []Option{{OptionId: "c"}, {OptionId: "d"}, {OptionId: "a"}},
+	})
+	if err != nil {
+		t.Fatalf("Update returned error: %s", err)
+	}
+
+	want := map[int]string{1: "a", 3: "c", 4: "d"}
+	if got := testOptionIds(reply.Selection.Options); !reflect.DeepEqual(got, want) {
+		t.Errorf("options = %v, want %v", got, want)
+	}
+
+	wantRetired := map[int]string{2: "b"}
+	if got := testOptionIds(reply.Selection.Retired); !reflect.DeepEqual(got, wantRetired) {
+		t.Errorf("retired = %v, want %v", got, wantRetired)
+	}
+
+	if len(reply.Added) != 1 || reply.Added[0].Number != 4 || len(reply.Retired) != 1 || reply.Retired[0].Number != 2 {
+		t.Errorf("added %v and retired %v, want 4 added and 2 retired", reply.Added, reply.Retired)
+	}
+
+	_, err = service.Update(ctx, UpdateSelectionRequest{
+		AppId:      "app",
+		InstanceId: "instance",
+		UserId:     "user",
+		Options:    []Option{{OptionId: "a"}, {OptionId: "a"}},
+	})
+
+	validationErr, ok := err.(ValidationError)
+	if !ok || validationErr.Field != "options" || validationErr.Token != "a" {
+		t.Errorf("error = %#v, want a ValidationError for option id a", err)
+	}
+
+	_, err = service.Update(ctx, UpdateSelectionRequest{
+		AppId:      "app",
+		InstanceId: "instance",
+		UserId:     "user",
+		Options:    []Option{{OptionId: "a"}, {Content: "B"}},
+	})
+
+	validationErr, ok = err.(ValidationError)
+	if !ok || validationErr.Field != "options" || validationErr.Message != "Option 2 has no option id. Updating a selection matches options by id, so every option needs one." {
+		t.Errorf("error = %#v, want a ValidationError for the option without an id", err)
+	}
+}
+
+func TestUpdateRetiresDuplicateNumbers(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryRepository()
+	service := newTestService(repository)
+
+	// Selections created before duplicate ids were rejected may list an id twice.
+	err := repository.CreateSelection(ctx, Selection{
+		AppId:      "app",
+		InstanceId: "instance",
+		UserId:     "user",
+		Options:    map[int]Option{1: {OptionId: "a"}, 2: {OptionId: "a"}, 3: {OptionId: "b"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateSelection returned error: %s", err)
+	}
+
+	reply, err := service.Update(ctx, UpdateSelectionRequest{
+		AppId:      "app",
+		InstanceId: "instance",
+		UserId:     "user",
+		Options:    []Option{{OptionId: "a"}, {OptionId: "b"}},
+	})
+	if err != nil {
+		t.Fatalf("Update returned error: %s", err)
+	}
+
+	want := map[int]string{1: "a", 3: "b"}
+	if got := testOptionIds(reply.Selection.Options); !reflect.DeepEqual(got, want) {
+		t.Errorf("options = %v, want %v", got, want)
+	}
+
+	wantRetired := map[int]string{2: "a"}
+	if got := testOptionIds(reply.Selection.Retired); !reflect.DeepEqual(got, wantRetired) {
+		t.Errorf("retired = %v, want %v", got, wantRetired)
+	}
+
+	_, err = service.Parse(ctx, ParseSelectionRequest{AppId: "app", InstanceId: "instance", UserId: "user", Content: "2"})
+
+	validationErr, ok := err.(ValidationError)
+	if !ok || validationErr.Reason != ReasonRetiredOption {
+		t.Errorf("Parse error = %#v, want a retired option", err)
+	}
+}
+
+func testOptionIds(options map[int]Option) map[int]string {
+	optionIds := map[int]string{}
+	for number, option := range options {
+		optionIds[number] = option.OptionId
+	}
+
+	return optionIds
+}
+
+func TestDeleteRemovesBallots(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryRepository()
+	service := newTestService(repository)
+
+	for _, userId := range []string{"one", "two", "three"} {
+		_, err := service.Create(ctx, CreateSelectionRequest{AppId: "app", InstanceId: "instance", UserId: userId, Options: []Option{{OptionId: "a"}}})
+		if err != nil {
+			t.Fatalf("Create returned error: %s", err)
+		}
+
+		_, err = service.Parse(ctx, ParseSelectionRequest{AppId: "app", InstanceId: "instance", UserId: userId, Content: "1"})
+		if err != nil {
+			t.Fatalf("Parse returned error: %s", err)
+		}
+	}
+
+	numBallots := func() int {
+		ballots, err := repository.Ballots(ctx, "app", "instance")
+		if err != nil {
+			t.Fatalf("Ballots returned error: %s", err)
+		}
+
+		return len(ballots)
+	}
+
+	_, err := service.Delete(ctx, DeleteSelectionRequest{AppId: "app", InstanceId: "instance", UserId: "one"})
+	if err != nil {
+		t.Fatalf("Delete returned error: %s", err)
+	}
+	if n := numBallots(); n != 2 {
+		t.Errorf("%d ballots after deleting a selection, want 2", n)
+	}
+
+	reply, err := service.Delete(ctx, DeleteSelectionRequest{AppId: "app", InstanceId: "instance", Instance: true})
+	if err != nil {
+		t.Fatalf("Delete returned error: %s", err)
+	}
+	if reply.Deleted != 2 {
+		t.Errorf("deleted %d selections, want 2", reply.Deleted)
+	}
+	if n := numBallots(); n != 0 {
+		t.Errorf("%d ballots after deleting the instance, want 0", n)
+	}
+}
+
+func TestDeleteExpiredSelectionsRemovesBallots(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryRepository()
+
+	err := repository.CreateSelection(ctx, Selection{AppId: "app", InstanceId: "instance", UserId: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("CreateSelection returned error: %s", err)
+	}
+
+	err = repository.CreateSelection(ctx, Selection{AppId: "app", InstanceId: "instance", UserId: "current"})
+	if err != nil {
+		t.Fatalf("CreateSelection returned error: %s", err)
+	}
+
+	// A ballot without a selection is left alone, so pruning only touches the ballots of
+	// the selections it expires.
+	for _, userId := range []string{"expired", "current", "orphaned"} {
+		err := repository.SaveBallot(ctx, Ballot{AppId: "app", InstanceId: "instance", UserId: userId})
+		if err != nil {
+			t.Fatalf("SaveBallot returned error: %s", err)
+		}
+	}
+
+	deleted, err := repository.DeleteExpiredSelections(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpiredSelections returned error: %s", err)
+	}
+	if deleted != 1 {
+		t.Errorf("deleted %d selections, want 1", deleted)
+	}
+
+	ballots, err := repository.Ballots(ctx, "app", "instance")
+	if err != nil {
+		t.Fatalf("Ballots returned error: %s", err)
+	}
+	userIds := map[string]bool{}
+	for _, ballot := range ballots {
+		userIds[ballot.UserId] = true
+	}
+
+	if len(userIds) != 2 || !userIds["current"] || !userIds["orphaned"] {
+		t.Errorf("ballots = %+v, want the ballots of current and orphaned", ballots)
+	}
+}
+
+func TestCreateRejectsPastExpiry(t *testing.T) {
+	tests := []struct {
+		name  string
+		req   CreateSelectionRequest
+		field string
+	}{
+		{"past expiry", CreateSelectionRequest{ExpiresAt: time.Now().Add(-time.Second)}, "expires_at"},
+		{"negative ttl", CreateSelectionRequest{Ttl: -time.Minute}, "ttl_seconds"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newTestService(NewMemoryRepository()).Create(context.Background(), test.req)
+
+			validationErr, ok := err.(ValidationError)
+			if !ok || validationErr.Field != test.field {
+				t.Errorf("error = %#v, want a ValidationError for %s", err, test.field)
+			}
+		})
+	}
+}
+
+func TestParseDryRun(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(NewMemoryRepository())
+
+	_, err := service.Create(ctx, CreateSelectionRequest{AppId: "app", InstanceId: "instance", UserId: "user", Options: []Option{{OptionId: "a"}, {OptionId: "b"}}})
+	if err != nil {
+		t.Fatalf("Create returned error: %s", err)
+	}
+
+	rankedOptions, err := service.Parse(ctx, ParseSelectionRequest{AppId: "app", InstanceId: "instance", UserId: "user", Content: "2 1", DryRun: true})
+	if err != nil {
+		t.Fatalf("Parse returned error: %s", err)
+	}
+	if len(rankedOptions) != 2 || rankedOptions[0].Option.OptionId != "b" {
+		t.Errorf("ranked options = %+v, want b then a", rankedOptions)
+	}
+
+	_, err = service.Ballot(ctx, BallotRequest{AppId: "app", InstanceId: "instance", UserId: "user"})
+	if _, ok := err.(NotFoundError); !ok {
+		t.Errorf("Ballot error = %#v, want a NotFoundError after a dry run", err)
+	}
+}
@@ -1,12 +1,17 @@
 package selection
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/jukeizu/selection/internal/requestid"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // SortStrategy defines an interface for sorting strategies.
@@ -25,8 +30,17 @@ func NewSorter(logger zerolog.Logger) Sorter {
 }
 
 // Sort sorts batch options by method.
-func (s Sorter) Sort(batchOptions []BatchOption, method SortMethod, sortKey string) []BatchOption {
+func (s Sorter) Sort(ctx context.Context, batchOptions []BatchOption, method SortMethod, sortKey string) []BatchOption {
+	s.logger = requestid.Logger(ctx, s.logger)
+
 	strategy := s.findSortStrategy(method, sortKey)
+	strategyName := strings.TrimPrefix(fmt.Sprintf("%T", strategy), "selection.")
+
+	_, span := tracer.Start(ctx, "Sorter.Sort", trace.WithAttributes(
+		attribute.String("selection.sort_strategy", strategyName),
+		attribute.Int("selection.num_batch_options", len(batchOptions)),
+	))
+	defer span.End()
 
 	s.logger.Info().
 		Str("sortMethod", string(method)).
@@ -34,6 +48,8 @@ func (s Sorter) Sort(batchOptions []BatchOption, method SortMethod, sortKey stri
 		Str("strategy", fmt.Sprintf("%#v", strategy)).
 		Msg("beginning batch options sort")
 
+	sortStrategies.WithLabelValues(strategyName).Inc()
+
 	sorted := strategy.Sort(batchOptions)
 
 	s.logger.Info().
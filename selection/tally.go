@@ -0,0 +1,230 @@
+package selection
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jukeizu/selection/internal/requestid"
+	"github.com/rs/zerolog"
+)
+
+// TallyMethod defines an interface for voting methods.
+type TallyMethod interface {
+	Tally(ballots []Ballot) TallyResult
+}
+
+// Tallier counts ballots.
+type Tallier struct {
+	logger zerolog.Logger
+}
+
+// NewTallier constructs a new Tallier.
+func NewTallier(logger zerolog.Logger) Tallier {
+	return Tallier{logger}
+}
+
+// Tally counts ballots by voting method.
+func (t Tallier) Tally(ctx context.Context, ballots []Ballot, method VotingMethod) TallyResult {
+	t.logger = requestid.Logger(ctx, t.logger)
+
+	tallyMethod := t.findTallyMethod(method)
+
+	t.logger.Info().
+		Str("votingMethod", string(method)).
+		Str("tallyMethod", fmt.Sprintf("%#v", tallyMethod)).
+		Int("numBallots", len(ballots)).
+		Msg("beginning ballot tally")
+
+	result := tallyMethod.Tally(ballots)
+
+	t.logger.Info().
+		Str("votingMethod", string(method)).
+		Str("tallyMethod", fmt.Sprintf("%#v", tallyMethod)).
+		Int("numBallots", len(ballots)).
+		Msg("finished ballot tally")
+
+	return result
+}
+
+func (t Tallier) findTallyMethod(method VotingMethod) TallyMethod {
+	t.logger.Info().
+		Str("votingMethod", string(method)).
+		Msg("finding a tally method for the provided voting method")
+
+	switch method {
+	case Runoff:
+		return InstantRunoff{}
+	case Borda:
+		return BordaCount{}
+	case Schulze:
+		return SchulzeMethod{}
+	case Approval:
+		return ApprovalVoting{}
+	case Plurality:
+		return PluralityVoting{}
+	}
+
+	t.logger.Info().
+		Str("votingMethod", string(method)).
+		Msg("couldn't find a tally method. Defaulting to InstantRunoff method")
+
+	return InstantRunoff{}
+}
+
+// PluralityVoting awards each ballot's highest ranked option one point.
+type PluralityVoting struct{}
+
+// Tally implements TallyMethod.
+func (t PluralityVoting) Tally(ballots []Ballot) TallyResult {
+	rankings := ballotRankings(ballots)
+	options := rankedOptionSet(rankings)
+
+	scores := zeroCounts(options)
+
+	for _, ranking := range rankings {
+		if len(ranking) < 1 {
+			continue
+		}
+
+		scores[ranking[0].Option.OptionId]++
+	}
+
+	return scoredTallyResult(Plurality, len(ballots), optionCounts(scores, options))
+}
+
+// ApprovalVoting awards one point to every option listed on a ballot, regardless of rank.
+type ApprovalVoting struct{}
+
+// Tally implements TallyMethod.
+func (t ApprovalVoting) Tally(ballots []Ballot) TallyResult {
+	rankings := ballotRankings(ballots)
+	options := rankedOptionSet(rankings)
+
+	scores := zeroCounts(options)
+
+	for _, ranking := range rankings {
+		for _, rankedOption := range uniqueRanking(ranking) {
+			scores[rankedOption.Option.OptionId]++
+		}
+	}
+
+	return scoredTallyResult(Approval, len(ballots), optionCounts(scores, options))
+}
+
+// BordaCount awards points by position. With n distinct options ranked across all
+// ballots, a ballot's first choice earns n-1 points, its second n-2 and so on. Options
+// no ballot ranks do not count towards n, and options a ballot leaves unranked earn
+// nothing from it.
+type BordaCount struct{}
+
+// Tally implements TallyMethod.
+func (t BordaCount) Tally(ballots []Ballot) TallyResult {
+	rankings := ballotRankings(ballots)
+	options := rankedOptionSet(rankings)
+
+	scores := zeroCounts(options)
+
+	for _, ranking := range rankings {
+		for position, rankedOption := range uniqueRanking(ranking) {
+			scores[rankedOption.Option.OptionId] += len(options) - 1 - position
+		}
+	}
+
+	return scoredTallyResult(Borda, len(ballots), optionCounts(scores, options))
+}
+
+func scoredTallyResult(method VotingMethod, numBallots int, scores []OptionCount) TallyResult {
+	result := TallyResult{
+		Method:     method,
+		NumBallots: numBallots,
+		Rounds:     []TallyRound{},
+		Scores:     scores,
+	}
+
+	if len(scores) > 0 {
+		result.Winner = &scores[0].Option
+	}
+
+	return result
+}
+
+// ballotRankings returns the ranked options of each ballot ordered by rank.
+func ballotRankings(ballots []Ballot) [][]RankedOption {
+	rankings := [][]RankedOption{}
+
+	for _, ballot := range ballots {
+		ranking := make([]RankedOption, len(ballot.Options))
+		copy(ranking, ballot.Options)
+
+		sort.SliceStable(ranking, func(i, j int) bool {
+			return ranking[i].Rank < ranking[j].Rank
+		})
+
+		rankings = append(rankings, ranking)
+	}
+
+	return rankings
+}
+
+// uniqueRanking returns ranking with repeated options removed, keeping the highest ranked occurrence.
+func uniqueRanking(ranking []RankedOption) []RankedOption {
+	seen := map[string]bool{}
+	unique := []RankedOption{}
+
+	for _, rankedOption := range ranking {
+		if seen[rankedOption.Option.OptionId] {
+			continue
+		}
+
+		seen[rankedOption.Option.OptionId] = true
+		unique = append(unique, rankedOption)
+	}
+
+	return unique
+}
+
+// rankedOptionSet returns every option that appears in rankings keyed by OptionId.
+func rankedOptionSet(rankings [][]RankedOption) map[string]Option {
+	options := map[string]Option{}
+
+	for _, ranking := range rankings {
+		for _, rankedOption := range ranking {
+			options[rankedOption.Option.OptionId] = rankedOption.Option
+		}
+	}
+
+	return options
+}
+
+func zeroCounts(options map[string]Option) map[string]int {
+	counts := map[string]int{}
+
+	for optionId := range options {
+		counts[optionId] = 0
+	}
+
+	return counts
+}
+
+// optionCounts converts counts keyed by OptionId to OptionCounts ordered by count, then OptionId.
+func optionCounts(counts map[string]int, options map[string]Option) []OptionCount {
+	optionCounts := []OptionCount{}
+
+	for optionId, count := range counts {
+		optionCounts = append(optionCounts, OptionCount{
+			Option: options[optionId],
+			Count:  count,
+		})
+	}
+
+	sort.Slice(optionCounts, func(i, j int) bool {
+		if optionCounts[i].Count != optionCounts[j].Count {
+			return optionCounts[i].Count > optionCounts[j].Count
+		}
+
+		return optionCounts[i].Option.OptionId < optionCounts[j].Option.OptionId
+	})
+
+	return optionCounts
+}
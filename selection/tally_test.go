@@ -0,0 +1,190 @@
+package selection
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestScoredTallyMethods(t *testing.T) {
+	// Approval counts every listed option, so it gets ballots that list only the voters'
+	// top two choices.
+	approvalBallots := []Ballot{}
+	approvalBallots = append(approvalBallots, testBallots(42, "memphis", "nashville")...)
+	approvalBallots = append(approvalBallots, testBallots(26, "nashville", "chattanooga")...)
+	approvalBallots = append(approvalBallots, testBallots(15, "chattanooga", "knoxville")...)
+	approvalBallots = append(approvalBallots, testBallots(17, "knoxville", "chattanooga")...)
+
+	tests := []struct {
+		name    string
+		method  TallyMethod
+		voting  VotingMethod
+		ballots []Ballot
+		winner  string
+		scores  []string
+	}{
+		{
+			name:    "plurality",
+			method:  PluralityVoting{},
+			voting:  Plurality,
+			ballots: tennesseeBallots(),
+			winner:  "memphis",
+			scores:  []string{"memphis=42", "nashville=26", "knoxville=17", "chattanooga=15"},
+		},
+		{
+			name:    "borda",
+			method:  BordaCount{},
+			voting:  Borda,
+			ballots: tennesseeBallots(),
+			winner:  "nashville",
+			scores:  []string{"nashville=194", "chattanooga=173", "memphis=126", "knoxville=107"},
+		},
+		{
+			name:    "schulze",
+			method:  SchulzeMethod{},
+			voting:  Schulze,
+			ballots: tennesseeBallots(),
+			winner:  "nashville",
+			scores:  []string{"nashville=3", "chattanooga=2", "knoxville=1", "memphis=0"},
+		},
+		{
+			name:    "approval",
+			method:  ApprovalVoting{},
+			voting:  Approval,
+			ballots: approvalBallots,
+			winner:  "nashville",
+			scores:  []string{"nashville=68", "chattanooga=58", "memphis=42", "knoxville=32"},
+		},
+		{
+			name:    "plurality tie broken by option id",
+			method:  PluralityVoting{},
+			voting:  Plurality,
+			ballots: append(testBallots(1, "b", "a"), testBallots(1, "a", "b")...),
+			winner:  "a",
+			scores:  []string{"a=1", "b=1"},
+		},
+		{
+			name:    "approval counts repeated options once",
+			method:  ApprovalVoting{},
+			voting:  Approval,
+			ballots: append(testBallots(1, "a", "a", "b"), testBallots(1, "b")...),
+			winner:  "b",
+			scores:  []string{"b=2", "a=1"},
+		},
+		{
+			name:    "borda scores unranked options zero",
+			method:  BordaCount{},
+			voting:  Borda,
+			ballots: append(testBallots(1, "a"), testBallots(1, "b", "c")...),
+			winner:  "a",
+			scores:  []string{"a=2", "b=2", "c=1"},
+		},
+		{
+			name:    "plurality skips empty ballots",
+			method:  PluralityVoting{},
+			voting:  Plurality,
+			ballots: append(testBallots(1), testBallots(1, "a")...),
+			winner:  "a",
+			scores:  []string{"a=1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.method.Tally(test.ballots)
+
+			if result.Method != test.voting || result.NumBallots != len(test.ballots) {
+				t.Errorf("method, ballots = %s, %d, want %s, %d", result.Method, result.NumBallots, test.voting, len(test.ballots))
+			}
+
+			if result.Winner == nil || result.Winner.OptionId != test.winner {
+				t.Errorf("winner = %v, want %s", result.Winner, test.winner)
+			}
+
+			if scores := testCounts(result.Scores); !reflect.DeepEqual(scores, test.scores) {
+				t.Errorf("scores = %v, want %v", scores, test.scores)
+			}
+		})
+	}
+}
+
+func TestScoredTallyMethodsNoBallots(t *testing.T) {
+	for _, method := range []TallyMethod{PluralityVoting{}, ApprovalVoting{}, BordaCount{}, SchulzeMethod{}} {
+		result := method.Tally(nil)
+
+		if result.Winner != nil || len(result.Scores) != 0 {
+			t.Errorf("%T.Tally(nil) = %+v, want no winner or scores", method, result)
+		}
+	}
+}
+
+func TestSchulzePairwise(t *testing.T) {
+	result := SchulzeMethod{}.Tally(tennesseeBallots())
+
+	pairwise := map[string]int{}
+	for _, count := range result.Pairwise {
+		pairwise[count.Option.OptionId+">"+count.Against.OptionId] = count.Count
+	}
+
+	want := map[string]int{
+		"memphis>nashville":     42,
+		"memphis>chattanooga":   42,
+		"memphis>knoxville":     42,
+		"nashville>memphis":     58,
+		"nashville>chattanooga": 68,
+		"nashville>knoxville":   68,
+		"chattanooga>memphis":   58,
+		"chattanooga>nashville": 32,
+		"chattanooga>knoxville": 83,
+		"knoxville>memphis":     58,
+		"knoxville>nashville":   32,
+		"knoxville>chattanooga": 17,
+	}
+
+	if !reflect.DeepEqual(pairwise, want) {
+		t.Errorf("pairwise = %v, want %v", pairwise, want)
+	}
+}
+
+func TestSchulzeCycle(t *testing.T) {
+	// a beats b 6-3, b beats c 7-2 and c beats a 5-4. The weakest link of the cycle is
+	// c over a, so a wins.
+	ballots := []Ballot{}
+	ballots = append(ballots, testBallots(4, "a", "b", "c")...)
+	ballots = append(ballots, testBallots(3, "b", "c", "a")...)
+	ballots = append(ballots, testBallots(2, "c", "a", "b")...)
+
+	result := SchulzeMethod{}.Tally(ballots)
+
+	want := []string{"a=2", "b=1", "c=0"}
+	if scores := testCounts(result.Scores); !reflect.DeepEqual(scores, want) {
+		t.Errorf("scores = %v, want %v", scores, want)
+	}
+}
+
+func TestTallierFindsMethod(t *testing.T) {
+	tallier := NewTallier(zerolog.Nop())
+
+	tests := []struct {
+		method VotingMethod
+		want   VotingMethod
+	}{
+		{Runoff, Runoff},
+		{Borda, Borda},
+		{Schulze, Schulze},
+		{Approval, Approval},
+		{Plurality, Plurality},
+		{"", Runoff},
+		{"unknown", Runoff},
+	}
+
+	for _, test := range tests {
+		result := tallier.Tally(context.Background(), tennesseeBallots(), test.method)
+
+		if result.Method != test.want {
+			t.Errorf("Tally with %q used %s, want %s", test.method, result.Method, test.want)
+		}
+	}
+}
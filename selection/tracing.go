@@ -0,0 +1,196 @@
+package selection
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the spans of this package through the global TracerProvider, which
+// discards them unless the server configured an exporter.
+var tracer = otel.Tracer("github.com/jukeizu/selection/selection")
+
+// endSpan records err, if any, on span and ends it. Missing rows are expected and are
+// not recorded as errors.
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// tracingService starts a span for every call to another Service.
+type tracingService struct {
+	service Service
+}
+
+// NewTracingService wraps service so that every call runs in its own span, with the
+// spans of the repository, Sorter and Batcher calls it makes as children.
+func NewTracingService(service Service) Service {
+	return tracingService{service}
+}
+
+func (s tracingService) Create(ctx context.Context, req CreateSelectionRequest) (SelectionReply, error) {
+	ctx, span := tracer.Start(ctx, "DefaultService.Create", trace.WithAttributes(requestAttributes(req.AppId, req.InstanceId)...))
+	reply, err := s.service.Create(ctx, req)
+	endSpan(span, err)
+	return reply, err
+}
+
+func (s tracingService) Get(ctx context.Context, req GetSelectionRequest) (Selection, error) {
+	ctx, span := tracer.Start(ctx, "DefaultService.Get", trace.WithAttributes(requestAttributes(req.AppId, req.InstanceId)...))
+	selection, err := s.service.Get(ctx, req)
+	endSpan(span, err)
+	return selection, err
+}
+
+func (s tracingService) Update(ctx context.Context, req UpdateSelectionRequest) (UpdateSelectionReply, error) {
+	ctx, span := tracer.Start(ctx, "DefaultService.Update", trace.WithAttributes(requestAttributes(req.AppId, req.InstanceId)...))
+	reply, err := s.service.Update(ctx, req)
+	endSpan(span, err)
+	return reply, err
+}
+
+func (s tracingService) Delete(ctx context.Context, req DeleteSelectionRequest) (DeleteSelectionReply, error) {
+	ctx, span := tracer.Start(ctx, "DefaultService.Delete", trace.WithAttributes(requestAttributes(req.AppId, req.InstanceId)...))
+	reply, err := s.service.Delete(ctx, req)
+	endSpan(span, err)
+	return reply, err
+}
+
+func (s tracingService) List(ctx context.Context, req ListSelectionsRequest) (ListSelectionsReply, error) {
+	ctx, span := tracer.Start(ctx, "DefaultService.List", trace.WithAttributes(requestAttributes(req.AppId, req.InstanceId)...))
+	reply, err := s.service.List(ctx, req)
+	endSpan(span, err)
+	return reply, err
+}
+
+func (s tracingService) Parse(ctx context.Context, req ParseSelectionRequest) ([]RankedOption, error) {
+	ctx, span := tracer.Start(ctx, "DefaultService.Parse", trace.WithAttributes(requestAttributes(req.AppId, req.InstanceId)...))
+	rankedOptions, err := s.service.Parse(ctx, req)
+	endSpan(span, err)
+	return rankedOptions, err
+}
+
+func (s tracingService) Query(ctx context.Context, req QuerySelectionRequest) (QuerySelectionReply, error) {
+	ctx, span := tracer.Start(ctx, "DefaultService.Query", trace.WithAttributes(requestAttributes(req.AppId, req.InstanceId)...))
+	reply, err := s.service.Query(ctx, req)
+	endSpan(span, err)
+	return reply, err
+}
+
+func (s tracingService) Ballot(ctx context.Context, req BallotRequest) (Ballot, error) {
+	ctx, span := tracer.Start(ctx, "DefaultService.Ballot", trace.WithAttributes(requestAttributes(req.AppId, req.InstanceId)...))
+	ballot, err := s.service.Ballot(ctx, req)
+	endSpan(span, err)
+	return ballot, err
+}
+
+func (s tracingService) Tally(ctx context.Context, req TallyRequest) (TallyResult, error) {
+	ctx, span := tracer.Start(ctx, "DefaultService.Tally", trace.WithAttributes(requestAttributes(req.AppId, req.InstanceId)...))
+	result, err := s.service.Tally(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+func requestAttributes(appId, instanceId string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("selection.app_id", appId),
+		attribute.String("selection.instance_id", instanceId),
+	}
+}
+
+// tracingRepository starts a span for every call to another Repository.
+type tracingRepository struct {
+	repository Repository
+}
+
+// NewTracingRepository wraps repository so that every call runs in its own span.
+func NewTracingRepository(repository Repository) Repository {
+	return tracingRepository{repository}
+}
+
+func (r tracingRepository) Migrate() error {
+	return r.repository.Migrate()
+}
+
+// Ping is not traced; health checks would otherwise start a trace every few seconds.
+func (r tracingRepository) Ping(ctx context.Context) error {
+	return r.repository.Ping(ctx)
+}
+
+func (r tracingRepository) CreateSelection(ctx context.Context, selection Selection) error {
+	ctx, span := tracer.Start(ctx, "Repository.CreateSelection")
+	err := r.repository.CreateSelection(ctx, selection)
+	endSpan(span, err)
+	return err
+}
+
+func (r tracingRepository) ReplaceSelection(ctx context.Context, selection Selection) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Repository.ReplaceSelection")
+	deleted, err := r.repository.ReplaceSelection(ctx, selection)
+	endSpan(span, err)
+	return deleted, err
+}
+
+func (r tracingRepository) Selection(ctx context.Context, appId, instanceId, userId, serverId string) (Selection, error) {
+	ctx, span := tracer.Start(ctx, "Repository.Selection")
+	selection, err := r.repository.Selection(ctx, appId, instanceId, userId, serverId)
+	endSpan(span, err)
+	return selection, err
+}
+
+func (r tracingRepository) ListSelections(ctx context.Context, filter SelectionFilter) ([]SelectionSummary, error) {
+	ctx, span := tracer.Start(ctx, "Repository.ListSelections")
+	summaries, err := r.repository.ListSelections(ctx, filter)
+	endSpan(span, err)
+	return summaries, err
+}
+
+func (r tracingRepository) DeleteSelection(ctx context.Context, appId, instanceId, userId, serverId string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Repository.DeleteSelection")
+	deleted, err := r.repository.DeleteSelection(ctx, appId, instanceId, userId, serverId)
+	endSpan(span, err)
+	return deleted, err
+}
+
+func (r tracingRepository) DeleteInstance(ctx context.Context, appId, instanceId string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Repository.DeleteInstance")
+	deleted, err := r.repository.DeleteInstance(ctx, appId, instanceId)
+	endSpan(span, err)
+	return deleted, err
+}
+
+func (r tracingRepository) DeleteExpiredSelections(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Repository.DeleteExpiredSelections")
+	deleted, err := r.repository.DeleteExpiredSelections(ctx)
+	endSpan(span, err)
+	return deleted, err
+}
+
+func (r tracingRepository) SaveBallot(ctx context.Context, ballot Ballot) error {
+	ctx, span := tracer.Start(ctx, "Repository.SaveBallot")
+	err := r.repository.SaveBallot(ctx, ballot)
+	endSpan(span, err)
+	return err
+}
+
+func (r tracingRepository) Ballot(ctx context.Context, appId, instanceId, userId, serverId string) (Ballot, error) {
+	ctx, span := tracer.Start(ctx, "Repository.Ballot")
+	ballot, err := r.repository.Ballot(ctx, appId, instanceId, userId, serverId)
+	endSpan(span, err)
+	return ballot, err
+}
+
+func (r tracingRepository) Ballots(ctx context.Context, appId, instanceId string) ([]Ballot, error) {
+	ctx, span := tracer.Start(ctx, "Repository.Ballots")
+	ballots, err := r.repository.Ballots(ctx, appId, instanceId)
+	endSpan(span, err)
+	return ballots, err
+}